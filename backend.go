@@ -0,0 +1,134 @@
+package fswatcher
+
+import (
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// The source of the notifications of a Watcher
+type backend interface {
+	Add(path string) error
+	Events() <-chan backendEvent
+	Errors() <-chan error
+	Close() error
+}
+
+// A notification of a backend: the portable operations of fsnotify, plus what only the
+// native backend can tell
+type backendEvent struct {
+	fsnotify.Event
+	// CloseWrite, Attrib or Overflow
+	extra Op
+	// identifies the two halves of a move, 0 when unknown
+	cookie uint32
+}
+
+func newBackend(native bool) (backend, error) {
+	if native {
+		return newInotifyBackend()
+	}
+	return newFsnotifyBackend()
+}
+
+// The portable backend
+type fsnotifyBackend struct {
+	watcher *fsnotify.Watcher
+	events  chan backendEvent
+	done    chan struct{}
+	once    sync.Once
+}
+
+func newFsnotifyBackend() (backend, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	b := &fsnotifyBackend{
+		watcher: watcher,
+		events:  make(chan backendEvent),
+		done:    make(chan struct{}),
+	}
+	go b.forward()
+	return b, nil
+}
+
+func (b *fsnotifyBackend) forward() {
+	defer close(b.events)
+	for event := range b.watcher.Events {
+		select {
+		case b.events <- backendEvent{Event: event}:
+		case <-b.done:
+			return
+		}
+	}
+}
+
+func (b *fsnotifyBackend) Add(path string) error {
+	return b.watcher.Add(path)
+}
+
+func (b *fsnotifyBackend) Events() <-chan backendEvent {
+	return b.events
+}
+
+func (b *fsnotifyBackend) Errors() <-chan error {
+	return b.watcher.Errors
+}
+
+func (b *fsnotifyBackend) Close() error {
+	b.once.Do(func() {
+		close(b.done)
+	})
+	return b.watcher.Close()
+}
+
+// Pairs the two halves of the moves seen by the watchers sharing it
+type moveTable struct {
+	mutex sync.Mutex
+	paths map[uint32]string
+	order []uint32
+}
+
+// moves out of the watched folders are never paired, only the latest ones are kept
+const maxPendingMoves = 64
+
+func newMoveTable() *moveTable {
+	return &moveTable{paths: make(map[uint32]string)}
+}
+
+// Remember the path moved away
+func (table *moveTable) from(cookie uint32, path string) {
+	if table == nil || cookie == 0 {
+		return
+	}
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	if len(table.order) >= maxPendingMoves {
+		delete(table.paths, table.order[0])
+		table.order = table.order[1:]
+	}
+	table.paths[cookie] = path
+	table.order = append(table.order, cookie)
+}
+
+// The path moved away with the same cookie, if any
+func (table *moveTable) to(cookie uint32) string {
+	if table == nil || cookie == 0 {
+		return ""
+	}
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	path, ok := table.paths[cookie]
+	if !ok {
+		return ""
+	}
+	delete(table.paths, cookie)
+	for i, c := range table.order {
+		if c == cookie {
+			table.order = append(table.order[:i], table.order[i+1:]...)
+			break
+		}
+	}
+	return path
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/raomuyang/fswatcher/sink"
+)
+
+func verifyAuditCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 1 || args[0] == "-h" || args[0] == "-help" {
+		fmt.Fprint(stderr, "Usage: fswatch verify-audit file\n\n"+
+			"Check the hash chain of an audit file written with -audit, print its last record.\n")
+		return 1
+	}
+	seq, hash, err := sink.VerifyAudit(args[0])
+	if err != nil {
+		fmt.Fprintf(stderr, "fswatch verify-audit: %s\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "records: %d, last hash: %s\n", seq, hash)
+	return 0
+}
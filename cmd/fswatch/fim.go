@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/raomuyang/fswatcher"
+	"github.com/raomuyang/fswatcher/fim"
+	fswlogrus "github.com/raomuyang/fswatcher/logrus"
+	"github.com/sirupsen/logrus"
+)
+
+// Status of fim check when the folder differs from the baseline
+const exitChanged = 3
+
+func fimCommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fswatch fim", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	baselinePath := flags.String("baseline", "fim.json", "the baseline file")
+	keyFile := flags.String("key-file", "", "the file of the key signing the baseline, $FSWATCH_FIM_KEY by default")
+	asJSON := flags.Bool("json", false, "print the changes as JSON lines")
+	interval := flags.Duration("interval", time.Hour, "watch: verify the whole folder at this interval, 0 to disable")
+	native := flags.Bool("native", false, "watch: use the native backend (Linux only), which reports the permission changes right away")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: fswatch fim init|check|watch [flags] [path]\n\n"+
+			"  init   record and sign the baseline of path, the current folder by default\n"+
+			"  check  report the differences with the baseline, exits with status %d if there are some\n"+
+			"  watch  report the differences with the baseline as the files change\n\n", exitChanged)
+		flags.PrintDefaults()
+	}
+	if len(args) == 0 || (args[0] != "init" && args[0] != "check" && args[0] != "watch") {
+		flags.Usage()
+		return 1
+	}
+	action := args[0]
+	if err := flags.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 1
+	}
+
+	fail := func(err error) int {
+		fmt.Fprintf(stderr, "fswatch fim: %s\n", err)
+		return 1
+	}
+	key, err := readKey(*keyFile)
+	if err != nil {
+		return fail(err)
+	}
+	// the baseline and the key are not part of the monitored folder
+	exclude := fim.WithExclude(*baselinePath)
+	if *keyFile != "" {
+		exclude = fim.WithExclude(*baselinePath, *keyFile)
+	}
+
+	if action == "init" {
+		path := "."
+		if flags.NArg() == 1 {
+			path = flags.Arg(0)
+		}
+		baseline, err := fim.Scan(path, exclude)
+		if err != nil {
+			return fail(err)
+		}
+		baseline.Sign(key)
+		if err := baseline.Save(*baselinePath); err != nil {
+			return fail(err)
+		}
+		fmt.Fprintf(stdout, "%d entries of %s recorded in %s\n", len(baseline.Entries), baseline.Root, *baselinePath)
+		return 0
+	}
+
+	baseline, err := fim.Load(*baselinePath, key)
+	if err != nil {
+		return fail(err)
+	}
+	path := baseline.Root
+	if flags.NArg() == 1 {
+		path = flags.Arg(0)
+	}
+	var mutex sync.Mutex
+	report := func(change fim.Change) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if *asJSON {
+			json.NewEncoder(stdout).Encode(change)
+		} else {
+			fmt.Fprintln(stdout, change)
+		}
+	}
+
+	if action == "check" {
+		changes, err := fim.Check(path, baseline, exclude)
+		for _, change := range changes {
+			report(change)
+		}
+		if err != nil {
+			return fail(err)
+		}
+		if len(changes) > 0 {
+			return exitChanged
+		}
+		return 0
+	}
+
+	logger := logrus.New()
+	logger.Out = stderr
+	opts := []fim.Option{exclude, fim.WithInterval(*interval), fim.WithLogger(fswlogrus.New(logger))}
+	if *native {
+		opts = append(opts, fim.WithWatchOptions(fswatcher.WithNativeBackend()))
+	}
+	m, err := fim.Watch(path, baseline, report, opts...)
+	if err != nil {
+		return fail(err)
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	<-interrupt
+	m.Stop()
+	<-m.Stopped()
+	return 0
+}
+
+// The key from the file, or from the environment
+func readKey(file string) ([]byte, error) {
+	if file == "" {
+		key := os.Getenv("FSWATCH_FIM_KEY")
+		if key == "" {
+			return nil, fmt.Errorf("a key is required: -key-file or $FSWATCH_FIM_KEY")
+		}
+		return []byte(key), nil
+	}
+	key, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	key = []byte(strings.TrimRight(string(key), "\r\n"))
+	if len(key) == 0 {
+		return nil, fmt.Errorf("empty key in %s", file)
+	}
+	return key, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/raomuyang/fswatcher/fswatchertest"
+)
+
+func TestFimCommand(t *testing.T) {
+	tree := fswatchertest.NewTree(t, "etc/", "etc/app.conf")
+	dir := t.TempDir()
+	baseline := filepath.Join(dir, "fim.json")
+	key := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(key, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fim := func(args ...string) (int, string) {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		status := run(append([]string{"fim", args[0], "-baseline", baseline, "-key-file", key}, args[1:]...), stdout, stderr)
+		return status, stdout.String() + stderr.String()
+	}
+	if status, out := fim("init", tree.Root); status != 0 {
+		t.Fatalf("init failed: %s", out)
+	}
+	if status, out := fim("check"); status != 0 || out != "" {
+		t.Errorf("expected no changes, got %d: %s", status, out)
+	}
+
+	tree.WriteFile("etc/app.conf", "changed")
+	status, out := fim("check")
+	if status != exitChanged || strings.TrimSpace(out) != "CONTENT "+tree.Path("etc/app.conf") {
+		t.Errorf("expected the change to be reported, got %d: %s", status, out)
+	}
+
+	ioutil.WriteFile(key, []byte("other"), 0600)
+	if status, out := fim("check"); status != 1 || !strings.Contains(out, "invalid baseline signature") {
+		t.Errorf("expected a signature error, got %d: %s", status, out)
+	}
+}
+
+func TestFimCommand_Defaults(t *testing.T) {
+	tree := fswatchertest.NewTree(t, "app.conf")
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(tree.Root); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	defer os.Setenv("FSWATCH_FIM_KEY", os.Getenv("FSWATCH_FIM_KEY"))
+	os.Setenv("FSWATCH_FIM_KEY", "secret")
+
+	fim := func(action string) (int, string) {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		status := run([]string{"fim", action}, stdout, stderr)
+		return status, stdout.String() + stderr.String()
+	}
+	// the baseline written in the folder is not part of it
+	for i := 0; i < 2; i++ {
+		if status, out := fim("init"); status != 0 || !strings.HasPrefix(out, "2 entries") {
+			t.Fatalf("init failed: %d: %s", status, out)
+		}
+		if status, out := fim("check"); status != 0 || out != "" {
+			t.Errorf("expected no changes, got %d: %s", status, out)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/raomuyang/fswatcher"
+	"github.com/raomuyang/fswatcher/hook"
+	fswlogrus "github.com/raomuyang/fswatcher/logrus"
+	"github.com/sirupsen/logrus"
+)
+
+func hookCommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fswatch hook", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	config := flags.String("config", "hooks.yml", "the YAML file of the hooks")
+	native := flags.Bool("native", false, "use the native backend (Linux only)")
+	flags.Usage = func() {
+		fmt.Fprint(stderr, "Usage: fswatch hook [flags] [path]\n\n"+
+			"Run the commands of the hooks matching the changes below path, the current folder by default.\n\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 1
+	}
+	path := "."
+	if flags.NArg() == 1 {
+		path = flags.Arg(0)
+	}
+
+	logger := logrus.New()
+	logger.Out = stderr
+	log := fswlogrus.New(logger)
+
+	hooks, err := hook.LoadConfig(*config)
+	if err != nil {
+		fmt.Fprintf(stderr, "fswatch hook: %s\n", err)
+		return 1
+	}
+	engine, err := hook.New(path, hooks, hook.WithLogger(log))
+	if err != nil {
+		fmt.Fprintf(stderr, "fswatch hook: %s\n", err)
+		return 1
+	}
+	opts := []fswatcher.Option{fswatcher.WithLogger(log)}
+	if *native {
+		opts = append(opts, fswatcher.WithNativeBackend())
+	}
+	dw, err := fswatcher.Handle(path, engine, opts...)
+	if err != nil {
+		fmt.Fprintf(stderr, "fswatch hook: %s\n", err)
+		return 1
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	<-interrupt
+	dw.Stop()
+	engine.Wait()
+	return 0
+}
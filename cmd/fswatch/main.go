@@ -0,0 +1,39 @@
+// fswatch reports the changes of files and folders, like inotifywait, on top of fswatcher.
+//
+//	fswatch [flags] path...
+//	fswatch run [flags] -- command [args...]
+//	fswatch hook [-config hooks.yml] [path]
+//	fswatch fim init|check|watch [flags] [path]
+//	fswatch verify-audit file
+//
+// The run command restarts a process when the files change, the hook command runs the
+// commands configured for the changed files (see package hook), the fim command reports the
+// changes since a signed baseline of the files (see package fim), and verify-audit checks an
+// audit file written with -audit (see package sink). See -help of each command for the flags.
+package main
+
+import (
+	"io"
+	"os"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// Run the command given by args, returns the exit status
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "run":
+			return runCommand(args[1:], stdout, stderr)
+		case "hook":
+			return hookCommand(args[1:], stdout, stderr)
+		case "fim":
+			return fimCommand(args[1:], stdout, stderr)
+		case "verify-audit":
+			return verifyAuditCommand(args[1:], stdout, stderr)
+		}
+	}
+	return watchCommand(args, stdout, stderr)
+}
@@ -0,0 +1,46 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+var killSignal os.Signal = syscall.SIGKILL
+
+var signals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL,
+	"TERM": syscall.SIGTERM,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+// Parse a signal name such as "TERM" or "SIGINT"
+func parseSignal(name string) (os.Signal, error) {
+	sig, ok := signals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return nil, fmt.Errorf("unknown signal: %s", name)
+	}
+	return sig, nil
+}
+
+// Start the command in a new process group, to stop its children as well
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func signalGroup(cmd *exec.Cmd, sig os.Signal) error {
+	return syscall.Kill(-cmd.Process.Pid, sig.(syscall.Signal))
+}
+
+func shellCommand(script string) *exec.Cmd {
+	return exec.Command("sh", "-c", script)
+}
@@ -0,0 +1,41 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var killSignal = os.Kill
+
+// Windows cannot deliver signals to another process: every signal kills the process
+func parseSignal(name string) (os.Signal, error) {
+	switch strings.TrimPrefix(strings.ToUpper(name), "SIG") {
+	case "INT", "TERM", "KILL", "HUP", "QUIT":
+		return os.Kill, nil
+	}
+	return nil, fmt.Errorf("unknown signal: %s", name)
+}
+
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// Kill the process and its descendants, there is no process group to signal
+func signalGroup(cmd *exec.Cmd, sig os.Signal) error {
+	kill := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid))
+	if err := kill.Run(); err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
+
+func shellCommand(script string) *exec.Cmd {
+	return exec.Command("cmd", "/C", script)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/raomuyang/fswatcher"
+)
+
+// Restarts a command when the watched files change
+type runner struct {
+	command []string
+	build   string
+	paths   []string
+	filters []*filter
+	opts    []fswatcher.Option
+	delay   time.Duration
+	signal  os.Signal
+	grace   time.Duration
+	stdout  io.Writer
+	stderr  io.Writer
+
+	events  chan fswatcher.Event
+	process *process
+}
+
+func runCommand(args []string, stdout, stderr io.Writer) int {
+	r, err := newRunner(args, stdout, stderr)
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		if err != errUsage {
+			fmt.Fprintf(stderr, "fswatch run: %s\n", err)
+		}
+		return 1
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	return r.run(interrupt)
+}
+
+var errUsage = fmt.Errorf("usage")
+
+func newRunner(args []string, stdout, stderr io.Writer) (*runner, error) {
+	flags := flag.NewFlagSet("fswatch run", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var paths, includes, excludes stringList
+	flags.Var(&paths, "path", "watch this path, the current folder without .git by default (repeatable)")
+	flags.Var(&includes, "include", "only restart for the paths matching this glob pattern (repeatable)")
+	flags.Var(&excludes, "exclude", "ignore the paths matching this glob pattern (repeatable)")
+	build := flags.String("build", "", "run this shell command before each start, the restart is aborted if it fails")
+	delay := flags.Duration("delay", 300*time.Millisecond, "wait for the changes to settle for this duration before restarting")
+	sig := flags.String("signal", "TERM", "stop the process group with this signal")
+	grace := flags.Duration("grace", 5*time.Second, "kill the process group if it did not exit within this duration after the signal")
+	native := flags.Bool("native", false, "use the native backend (Linux only)")
+	sparse := flags.Bool("sparse", false, "only watch the folders which may contain paths matching the -include patterns")
+	flags.Usage = func() {
+		fmt.Fprint(stderr, "Usage: fswatch run [flags] -- command [args...]\n\n"+
+			"Start the command, and restart it when the files below the watched paths change.\n\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return nil, errUsage
+	}
+
+	r := &runner{
+		command: flags.Args(),
+		build:   *build,
+		paths:   paths,
+		delay:   *delay,
+		grace:   *grace,
+		stdout:  stdout,
+		stderr:  stderr,
+		events:  make(chan fswatcher.Event, 1),
+	}
+	if len(r.paths) == 0 {
+		r.paths = []string{"."}
+		excludes = append(excludes, ".git", ".git/**")
+	}
+	var err error
+	if r.signal, err = parseSignal(*sig); err != nil {
+		return nil, err
+	}
+	if *native {
+		r.opts = append(r.opts, fswatcher.WithNativeBackend())
+	}
+	if *sparse {
+		opt, err := sparseOption(includes)
+		if err != nil {
+			return nil, err
+		}
+		r.opts = append(r.opts, opt)
+	}
+	for _, path := range r.paths {
+		f, err := newFilter(path, includes, excludes)
+		if err != nil {
+			return nil, err
+		}
+		r.filters = append(r.filters, f)
+	}
+	return r, nil
+}
+
+// Watch, start the command and restart it on changes until stop, returns the exit status
+func (r *runner) run(stop <-chan os.Signal) int {
+	for i, path := range r.paths {
+		f := r.filters[i]
+		dw, err := fswatcher.Handle(path, fswatcher.HandlerFunc(func(event fswatcher.Event) error {
+			if !f.accept(event.Path) {
+				return fswatcher.ErrUnhandled
+			}
+			select {
+			case r.events <- event:
+			default:
+				// a restart is pending anyway
+			}
+			return nil
+		}), r.opts...)
+		if err != nil {
+			r.logf("%s", err)
+			return 1
+		}
+		defer dw.Stop()
+	}
+
+	r.restart()
+	var settled <-chan time.Time
+	var timer *time.Timer
+	var cause fswatcher.Event
+	for {
+		var exited <-chan struct{}
+		if r.process != nil {
+			exited = r.process.done
+		}
+		select {
+		case event := <-r.events:
+			cause = event
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.NewTimer(r.delay)
+			settled = timer.C
+		case <-settled:
+			settled = nil
+			r.logf("%s, restarting", cause)
+			r.restart()
+		case <-exited:
+			r.logf("%s, waiting for changes", r.process.state())
+			r.process = nil
+		case <-stop:
+			if r.process != nil {
+				r.process.stop(r.signal, r.grace)
+			}
+			return 0
+		}
+	}
+}
+
+// Build, then replace the running process. The process is left running if the build fails.
+// A change received meanwhile stays pending and restarts the process once more, so the files
+// written by the build should be excluded.
+func (r *runner) restart() {
+	if r.build != "" {
+		cmd := shellCommand(r.build)
+		cmd.Stdout, cmd.Stderr = r.stdout, r.stderr
+		if err := cmd.Run(); err != nil {
+			r.logf("build failed: %s", err)
+			return
+		}
+	}
+	if r.process != nil {
+		r.process.stop(r.signal, r.grace)
+		r.process = nil
+	}
+	p, err := startProcess(r.command, r.stdout, r.stderr)
+	if err != nil {
+		r.logf("%s", err)
+		return
+	}
+	r.process = p
+}
+
+func (r *runner) logf(format string, args ...interface{}) {
+	fmt.Fprintf(r.stderr, "fswatch run: "+format+"\n", args...)
+}
+
+// A started command, in its own process group. It gets no stdin: reading the terminal from
+// a background process group would stop it (SIGTTIN).
+type process struct {
+	cmd  *exec.Cmd
+	done chan struct{}
+	err  error
+}
+
+func startProcess(command []string, stdout, stderr io.Writer) (*process, error) {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	p := &process{cmd: cmd, done: make(chan struct{})}
+	go func() {
+		p.err = p.cmd.Wait()
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// Signal the process group, and kill it if it did not exit after grace
+func (p *process) stop(sig os.Signal, grace time.Duration) {
+	select {
+	case <-p.done:
+		return
+	default:
+	}
+	signalGroup(p.cmd, sig)
+	select {
+	case <-p.done:
+	case <-time.After(grace):
+		signalGroup(p.cmd, killSignal)
+		<-p.done
+	}
+}
+
+// How the process exited, once done is closed
+func (p *process) state() string {
+	if p.err != nil {
+		return "process " + p.err.Error()
+	}
+	return "process exited"
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/raomuyang/fswatcher/fswatchertest"
+)
+
+// A buffer written by the child processes while the test reads it
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
+func waitOutput(t *testing.T, out *syncBuffer, s string, count int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for strings.Count(out.String(), s) < count {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %d times %q in %q", count, s, out)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func startRunner(t *testing.T, args ...string) (stdout *syncBuffer, stop func()) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	stdout = &syncBuffer{}
+	stderr := &syncBuffer{}
+	r, err := newRunner(args, stdout, stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	interrupt := make(chan os.Signal)
+	done := make(chan int)
+	go func() {
+		done <- r.run(interrupt)
+	}()
+	return stdout, func() {
+		interrupt <- os.Interrupt
+		if status := <-done; status != 0 {
+			t.Errorf("expected status 0, got %d: %s", status, stderr)
+		}
+	}
+}
+
+func TestRunner_Restart(t *testing.T) {
+	tree := fswatchertest.NewTree(t)
+	stdout, stop := startRunner(t, "-path", tree.Root, "-exclude", "*.log", "-delay", "50ms", "-grace", "2s",
+		"--", "sh", "-c", "echo started; exec sleep 30")
+
+	waitOutput(t, stdout, "started", 1)
+	tree.WriteFile("a.log", "")
+	tree.WriteFile("b.go", "")
+	tree.AppendFile("b.go", "package b")
+	waitOutput(t, stdout, "started", 2)
+	time.Sleep(200 * time.Millisecond)
+	if n := strings.Count(stdout.String(), "started"); n != 2 {
+		t.Errorf("expected a single restart, got %d starts", n)
+	}
+	stop()
+}
+
+func TestRunner_BuildFailure(t *testing.T) {
+	tree := fswatchertest.NewTree(t, "broken")
+	stdout, stop := startRunner(t, "-path", tree.Root, "-delay", "50ms",
+		"-build", "echo building; test ! -e "+tree.Path("broken"),
+		"--", "sh", "-c", "echo started; exec sleep 30")
+
+	waitOutput(t, stdout, "building", 1)
+	tree.Remove("broken")
+	waitOutput(t, stdout, "started", 1)
+	if n := strings.Count(stdout.String(), "building"); n != 2 {
+		t.Errorf("expected 2 builds, got %d", n)
+	}
+	stop()
+}
+
+func TestRunner_BuildWrites(t *testing.T) {
+	tree := fswatchertest.NewTree(t)
+	stdout, stop := startRunner(t, "-path", tree.Root, "-exclude", "out", "-delay", "50ms",
+		"-build", "echo building; touch "+tree.Path("out")+"; sleep 0.2",
+		"--", "sh", "-c", "echo started; exec sleep 30")
+
+	waitOutput(t, stdout, "started", 1)
+	time.Sleep(500 * time.Millisecond)
+	if n := strings.Count(stdout.String(), "building"); n != 1 {
+		t.Errorf("expected the excluded build output not to trigger a restart, got %d builds", n)
+	}
+
+	tree.WriteFile("a.go", "")
+	waitOutput(t, stdout, "started", 2)
+	time.Sleep(500 * time.Millisecond)
+	if n := strings.Count(stdout.String(), "building"); n != 2 {
+		t.Errorf("expected 2 builds, got %d", n)
+	}
+	stop()
+}
+
+func TestRunner_ChangeDuringBuild(t *testing.T) {
+	tree := fswatchertest.NewTree(t)
+	stdout, stop := startRunner(t, "-path", tree.Root, "-delay", "50ms",
+		"-build", "echo building; sleep 0.3",
+		"--", "sh", "-c", "echo started; exec sleep 30")
+
+	waitOutput(t, stdout, "started", 1)
+	tree.WriteFile("a.go", "")
+	waitOutput(t, stdout, "building", 2)
+	// edited while building: restarted once more once the build completed
+	tree.WriteFile("a.go", "package a")
+	waitOutput(t, stdout, "started", 3)
+	time.Sleep(500 * time.Millisecond)
+	if n := strings.Count(stdout.String(), "started"); n != 3 {
+		t.Errorf("expected 3 starts, got %d", n)
+	}
+	stop()
+}
+
+func TestRunner_DefaultExcludesGit(t *testing.T) {
+	r, err := newRunner([]string{"--", "true"}, &bytes.Buffer{}, &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.filters[0].accept(filepath.Join(".git", "index")) || r.filters[0].accept(".git") {
+		t.Error("expected .git to be excluded")
+	}
+	if !r.filters[0].accept(filepath.Join("src", "a.go")) {
+		t.Error("expected src/a.go to be accepted")
+	}
+}
+
+func TestRunner_NoStdin(t *testing.T) {
+	tree := fswatchertest.NewTree(t)
+	// reading stdin ends at once instead of stopping the background process group
+	stdout, stop := startRunner(t, "-path", tree.Root,
+		"--", "sh", "-c", "cat; echo read; exec sleep 30")
+
+	waitOutput(t, stdout, "read", 1)
+	stop()
+}
+
+func TestParseSignal(t *testing.T) {
+	for _, name := range []string{"TERM", "sigint", "KILL"} {
+		if _, err := parseSignal(name); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := parseSignal("FOO"); err == nil {
+		t.Error("expected an error for an unknown signal")
+	}
+}
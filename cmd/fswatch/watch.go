@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/raomuyang/fswatcher"
+	"github.com/raomuyang/fswatcher/sink"
+)
+
+// Exit status when the timeout expired before any event
+const exitTimeout = 2
+
+// A flag which can be given several times
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+func watchCommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fswatch", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", "plain",
+		"output format: plain, json (JSON lines), null (NUL separated paths),\n"+
+			"or a Go template such as '{{.Op}} {{.Path}}' (fields: Op, Path, OldPath, Time, Meta)")
+	var includes, excludes stringList
+	flags.Var(&includes, "include", "only report the paths matching this glob pattern (repeatable)")
+	flags.Var(&excludes, "exclude", "do not report the paths matching this glob pattern (repeatable)")
+	events := flags.String("events", "", "only report these operations, e.g. create,write")
+	depth := flags.Int("depth", -1, "watch the folders up to this depth below the target, 0 for the target only, -1 for no limit")
+	once := flags.Bool("once", false, "exit after the first event")
+	timeout := flags.Duration("timeout", 0, fmt.Sprintf("exit after this duration, with status %d if no event was reported", exitTimeout))
+	native := flags.Bool("native", false, "use the native backend (Linux only), which reports close_write, attrib and overflow as well")
+	sparse := flags.Bool("sparse", false, "only watch the folders which may contain paths matching the -include patterns")
+	syslog := flags.String("syslog", "", "send the events to syslog as well: local, or network://address with unix, unixgram or udp")
+	workers := flags.Int("workers", 1, "watch the folders of each path with this number of goroutines, in the background")
+	policy := flags.String("policy", "best-effort", "when a folder cannot be watched: best-effort (warn), fail-fast (exit) or retry (every 30s)")
+	progress := flags.Bool("progress", false, "print the progress of the traversal of each path on stderr")
+	audit := flags.String("audit", "", "append the events to this hash-chained audit file as well, see fswatch verify-audit")
+	flags.Usage = func() {
+		fmt.Fprint(stderr, "Usage: fswatch [flags] path...\n\n"+
+			"Print the changes of the files and folders below each path.\n"+
+			"Glob patterns support *, ?, **, [abc] and {a,b}, relative to the watched path;\n"+
+			"a pattern without / matches the file name in any folder.\n\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 1
+	}
+
+	fail := func(err error) int {
+		fmt.Fprintf(stderr, "fswatch: %s\n", err)
+		return 1
+	}
+	printer, err := newPrinter(*format, stdout)
+	if err != nil {
+		return fail(err)
+	}
+	var ops fswatcher.Op
+	if *events != "" {
+		ops, err = fswatcher.ParseOp(strings.Replace(*events, ",", "|", -1))
+		if err != nil {
+			return fail(err)
+		}
+	}
+	opts := []fswatcher.Option{fswatcher.WithMaxDepth(*depth)}
+	if *native {
+		opts = append(opts, fswatcher.WithNativeBackend())
+	}
+	if *sparse {
+		opt, err := sparseOption(includes)
+		if err != nil {
+			return fail(err)
+		}
+		opts = append(opts, opt)
+	}
+
+	watchPolicy, ok := watchPolicies[*policy]
+	if !ok {
+		return fail(fmt.Errorf("unknown policy: %s", *policy))
+	}
+	opts = append(opts, fswatcher.WithWatchPolicy(watchPolicy))
+
+	reporter := newReporter(printer, *once)
+	if *syslog != "" {
+		s, err := dialSyslog(*syslog)
+		if err != nil {
+			return fail(err)
+		}
+		defer s.Close()
+		reporter.sinks = append(reporter.sinks, s)
+	}
+	if *audit != "" {
+		a, err := sink.OpenAudit(*audit)
+		if err != nil {
+			return fail(err)
+		}
+		defer a.Close()
+		reporter.sinks = append(reporter.sinks, a)
+	}
+	var watches []*fswatcher.DeepWatch
+	defer func() {
+		for _, dw := range watches {
+			dw.Stop()
+		}
+	}()
+	for _, path := range flags.Args() {
+		filter, err := newFilter(path, includes, excludes)
+		if err != nil {
+			return fail(err)
+		}
+		handler := fswatcher.HandlerFunc(func(event fswatcher.Event) error {
+			if (ops != 0 && event.Op&ops == 0) || !filter.accept(event.Path) {
+				return fswatcher.ErrUnhandled
+			}
+			return reporter.report(event)
+		})
+		pathOpts := append([]fswatcher.Option{fswatcher.WithWorkers(*workers)}, opts...)
+		if *progress {
+			pathOpts = append(pathOpts, fswatcher.WithProgress(progressPrinter(path, stderr)))
+		}
+		dw, err := fswatcher.Handle(path, handler, pathOpts...)
+		if err != nil {
+			return fail(err)
+		}
+		watches = append(watches, dw)
+		if errs := dw.Errors(); errs != nil {
+			fmt.Fprintf(stderr, "fswatch: warning: %s\n", errs)
+		}
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	var deadline <-chan time.Time
+	if *timeout > 0 {
+		deadline = time.After(*timeout)
+	}
+
+	for {
+		select {
+		case <-reporter.reported:
+			if *once {
+				return 0
+			}
+		case err := <-reporter.failed:
+			return fail(err)
+		case <-deadline:
+			if reporter.count() == 0 {
+				return exitTimeout
+			}
+			return 0
+		case <-interrupt:
+			return 0
+		}
+	}
+}
+
+var watchPolicies = map[string]fswatcher.WatchPolicy{
+	"best-effort": fswatcher.BestEffort,
+	"fail-fast":   fswatcher.FailFast,
+	"retry":       fswatcher.RetryFailed,
+}
+
+// Print the progress of the traversal of path
+func progressPrinter(path string, w io.Writer) func(fswatcher.Progress) {
+	return func(progress fswatcher.Progress) {
+		state := "watching"
+		if progress.Done {
+			state = "ready"
+		}
+		fmt.Fprintf(w, "fswatch: %s: %s, %d folders listed, %d watched, %d errors\n",
+			path, state, progress.Dirs, progress.Watches, progress.Errors)
+	}
+}
+
+// Prints the events accepted, from any number of watchers
+type reporter struct {
+	printer  *printer
+	sinks    []fswatcher.Handler
+	once     bool
+	mutex    sync.Mutex
+	printed  int
+	reported chan struct{}
+	failed   chan error
+}
+
+func newReporter(printer *printer, once bool) *reporter {
+	return &reporter{
+		printer:  printer,
+		once:     once,
+		reported: make(chan struct{}, 1),
+		failed:   make(chan error, 1),
+	}
+}
+
+func (r *reporter) report(event fswatcher.Event) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.once && r.printed > 0 {
+		return fswatcher.ErrUnhandled
+	}
+	err := r.printer.print(event)
+	for _, s := range r.sinks {
+		if err == nil {
+			err = s.Handle(event)
+		}
+	}
+	if err != nil {
+		select {
+		case r.failed <- err:
+		default:
+		}
+		return err
+	}
+	r.printed++
+	select {
+	case r.reported <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// A syslog sink from the value of the -syslog flag
+func dialSyslog(value string) (*sink.Syslog, error) {
+	if value == "local" {
+		return sink.DialSyslog(sink.SyslogOptions{})
+	}
+	parts := strings.SplitN(value, "://", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid syslog address: %s", value)
+	}
+	return sink.DialSyslog(sink.SyslogOptions{Network: parts[0], Address: parts[1]})
+}
+
+func (r *reporter) count() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.printed
+}
+
+// Writes the events in one of the output formats
+type printer struct {
+	w      *bufio.Writer
+	format func(w io.Writer, event fswatcher.Event) error
+}
+
+func newPrinter(format string, w io.Writer) (*printer, error) {
+	p := &printer{w: bufio.NewWriter(w)}
+	switch format {
+	case "plain":
+		p.format = func(w io.Writer, event fswatcher.Event) error {
+			_, err := fmt.Fprintln(w, event)
+			return err
+		}
+	case "json":
+		p.format = func(w io.Writer, event fswatcher.Event) error {
+			return json.NewEncoder(w).Encode(event)
+		}
+	case "null":
+		p.format = func(w io.Writer, event fswatcher.Event) error {
+			_, err := fmt.Fprint(w, event.Path, "\x00")
+			return err
+		}
+	default:
+		if !strings.Contains(format, "{{") {
+			return nil, fmt.Errorf("unknown format: %s", format)
+		}
+		tmpl, err := template.New("format").Parse(format)
+		if err != nil {
+			return nil, err
+		}
+		p.format = func(w io.Writer, event fswatcher.Event) error {
+			if err := tmpl.Execute(w, event); err != nil {
+				return err
+			}
+			_, err := fmt.Fprintln(w)
+			return err
+		}
+	}
+	return p, nil
+}
+
+// Write event and flush, the output is usually read by another process as it comes
+func (p *printer) print(event fswatcher.Event) error {
+	if err := p.format(p.w, event); err != nil {
+		return err
+	}
+	return p.w.Flush()
+}
+
+// The decision of the filter for the paths matching a pattern
+type verdict bool
+
+func (v verdict) Handle(event fswatcher.Event) error {
+	return nil
+}
+
+// Accepts the paths by include and exclude patterns, the most specific matching pattern wins
+// and an exclude wins over an include as specific
+type filter struct {
+	mux *fswatcher.Mux
+}
+
+func newFilter(path string, includes, excludes []string) (*filter, error) {
+	root := path
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		root = filepath.Dir(path)
+	}
+	f := &filter{mux: fswatcher.NewMux(root)}
+	f.mux.Fallback(verdict(len(includes) == 0))
+
+	// the Mux picks the first pattern registered among the most specific ones
+	for _, pattern := range excludes {
+		if err := f.mux.Add(anywhere(pattern), verdict(false)); err != nil {
+			return nil, err
+		}
+	}
+	for _, pattern := range includes {
+		if err := f.mux.Add(anywhere(pattern), verdict(true)); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Watch the folders which may contain paths matching the includes only, see fswatcher.WithSparseWatch
+func sparseOption(includes []string) (fswatcher.Option, error) {
+	if len(includes) == 0 {
+		return nil, fmt.Errorf("-sparse requires -include")
+	}
+	patterns := make([]string, len(includes))
+	for i, pattern := range includes {
+		patterns[i] = anywhere(pattern)
+	}
+	return fswatcher.WithSparseWatch(patterns...), nil
+}
+
+// A pattern without / matches the file name in any folder
+func anywhere(pattern string) string {
+	if strings.Contains(pattern, "/") {
+		return pattern
+	}
+	return "**/" + pattern
+}
+
+func (f *filter) accept(path string) bool {
+	accepted, _ := f.mux.Match(path).(verdict)
+	return bool(accepted)
+}
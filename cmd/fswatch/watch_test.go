@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raomuyang/fswatcher"
+	"github.com/raomuyang/fswatcher/fswatchertest"
+)
+
+func TestFilter(t *testing.T) {
+	tree := fswatchertest.NewTree(t, "vendor/")
+	f, err := newFilter(tree.Root, []string{"*.go"}, []string{"*_test.go", "vendor/**"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]bool{
+		"main.go":       true,
+		"a/b/c.go":      true,
+		"a/b/c_test.go": false,
+		"vendor/x.go":   false,
+		"README.md":     false,
+	}
+	for path, expected := range cases {
+		if f.accept(tree.Path(path)) != expected {
+			t.Errorf("%s: expected %v", path, expected)
+		}
+	}
+
+	// as specific as the include, the exclude wins
+	f, err = newFilter(tree.Root, []string{"a?.go", "gen/*"}, []string{"?b.go", "gen/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"ab.go", "gen/a.txt"} {
+		if f.accept(tree.Path(path)) {
+			t.Errorf("%s: expected excluded", path)
+		}
+	}
+
+	if _, err := newFilter(tree.Root, []string{"{a"}, nil); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+func TestPrinter(t *testing.T) {
+	event := fswatcher.Event{Op: fswatcher.Create, Path: "a/b", OldPath: "a/c"}
+	cases := map[string]string{
+		"plain":                          "CREATE a/b\n",
+		"null":                           "a/b\x00",
+		"{{.Op}}:{{.OldPath}}>{{.Path}}": "CREATE:a/c>a/b\n",
+	}
+	for format, expected := range cases {
+		out := &bytes.Buffer{}
+		p, err := newPrinter(format, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.print(event)
+		if out.String() != expected {
+			t.Errorf("%s: expected %q, got %q", format, expected, out.String())
+		}
+	}
+
+	if _, err := newPrinter("yaml", &bytes.Buffer{}); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestWatchCommand_Once(t *testing.T) {
+	tree := fswatchertest.NewTree(t)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	audit := filepath.Join(t.TempDir(), "audit")
+
+	done := make(chan int)
+	go func() {
+		done <- run([]string{"-once", "-format", "json", "-include", "*.txt", "-timeout", "5s", "-audit", audit, tree.Root}, stdout, stderr)
+	}()
+
+	// the watch starts in the background: write until the first event is reported
+	for i := 0; ; i++ {
+		select {
+		case status := <-done:
+			if status != 0 {
+				t.Fatalf("expected status 0, got %d: %s", status, stderr)
+			}
+			var event fswatcher.Event
+			if err := json.Unmarshal(stdout.Bytes(), &event); err != nil {
+				t.Fatalf("invalid output %q: %s", stdout, err)
+			}
+			if event.Op != fswatcher.Create || filepath.Ext(event.Path) != ".txt" {
+				t.Errorf("unexpected event %s", event)
+			}
+			out := &bytes.Buffer{}
+			if status := run([]string{"verify-audit", audit}, out, out); status != 0 || !strings.HasPrefix(out.String(), "records: 1,") {
+				t.Errorf("expected an audit file with the event, got %d: %s", status, out)
+			}
+			return
+		case <-time.After(20 * time.Millisecond):
+			tree.WriteFile("ignored"+strconv.Itoa(i), "")
+			tree.WriteFile("file"+strconv.Itoa(i)+".txt", "")
+		}
+	}
+}
+
+func TestWatchCommand_Timeout(t *testing.T) {
+	tree := fswatchertest.NewTree(t)
+	status := run([]string{"-timeout", "50ms", tree.Root}, &bytes.Buffer{}, &bytes.Buffer{})
+	if status != exitTimeout {
+		t.Errorf("expected status %d, got %d", exitTimeout, status)
+	}
+
+	if status := run([]string{tree.Path("missing")}, &bytes.Buffer{}, &bytes.Buffer{}); status != 1 {
+		t.Errorf("expected status 1 for a missing path, got %d", status)
+	}
+}
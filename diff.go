@@ -0,0 +1,177 @@
+package fswatcher
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"unicode/utf8"
+)
+
+// Options of a Differ
+type DiffOptions struct {
+	// Larger files are not diffed, 1 MiB by default
+	MaxFileSize int64
+	// Total size of the cached contents, the least recently changed files are evicted
+	// beyond it, 64 MiB by default
+	MaxCacheSize int64
+	// Lines of context around the changes, 3 by default, negative for none
+	Context int
+}
+
+// Keeps the last seen content of the text files to add the unified diff of their changes
+// to the events, in Meta["diff"]:
+//
+//	differ := fswatcher.NewDiffer(fswatcher.DiffOptions{})
+//	differ.Preload("/etc/app")
+//	dw, err := fswatcher.Handle("/etc/app", fswatcher.Chain(handler, differ.Middleware))
+//
+// The diff is added to the Write, Create and Recreate events of a file whose previous content
+// is cached: a file is cached when it is preloaded, reported Existing (see WithInitialScan)
+// or changed, and stays cached when it is removed or renamed, for the diff of a file replaced
+// by another one (the atomic save of the editors). Binary files and the files above MaxFileSize are not cached.
+type Differ struct {
+	opts DiffOptions
+
+	mutex sync.Mutex
+	files map[string]*list.Element
+	lru   *list.List
+	size  int64
+}
+
+type cachedFile struct {
+	path    string
+	content string
+}
+
+func NewDiffer(opts DiffOptions) *Differ {
+	if opts.MaxFileSize <= 0 {
+		opts.MaxFileSize = 1 << 20
+	}
+	if opts.MaxCacheSize <= 0 {
+		opts.MaxCacheSize = 64 << 20
+	}
+	if opts.Context == 0 {
+		opts.Context = 3
+	} else if opts.Context < 0 {
+		opts.Context = 0
+	}
+	return &Differ{opts: opts, files: make(map[string]*list.Element), lru: list.New()}
+}
+
+// Add the diff to the events with NewDiffer(opts).Middleware
+func Diff(opts DiffOptions) Middleware {
+	return NewDiffer(opts).Middleware
+}
+
+// Cache the content of the text files below root, so that their first change has a diff
+func (d *Differ) Preload(root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			d.Update(path)
+		}
+		return nil
+	})
+}
+
+// Pass the events to next with the diff of the changed files
+func (d *Differ) Middleware(next Handler) Handler {
+	return HandlerFunc(func(event Event) error {
+		if event.Op&(Write|Create|Recreate|Existing) == 0 {
+			return next.Handle(event)
+		}
+		if event.OldPath != "" {
+			d.forget(event.OldPath)
+		}
+		if diff := d.Update(event.Path); diff != "" {
+			meta := make(map[string]string, len(event.Meta)+1)
+			for key, value := range event.Meta {
+				meta[key] = value
+			}
+			meta["diff"] = diff
+			event.Meta = meta
+		}
+		return next.Handle(event)
+	})
+}
+
+// Read the file at path and return the diff with its cached content, empty if the
+// content is the same, was not cached, or the file cannot be diffed
+func (d *Differ) Update(path string) string {
+	content, ok := d.read(path)
+	if !ok {
+		d.forget(path)
+		return ""
+	}
+
+	d.mutex.Lock()
+	previous, cached := d.swap(path, content)
+	d.mutex.Unlock()
+	if !cached {
+		return ""
+	}
+	return unifiedDiff(path, previous, content, d.opts.Context)
+}
+
+// The content of the text file at path
+func (d *Differ) read(path string) (string, bool) {
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > d.opts.MaxFileSize {
+		return "", false
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer file.Close()
+	// the file may grow while it is read
+	data, err := ioutil.ReadAll(io.LimitReader(file, d.opts.MaxFileSize+1))
+	if err != nil || int64(len(data)) > d.opts.MaxFileSize {
+		return "", false
+	}
+	if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		return "", false
+	}
+	return string(data), true
+}
+
+// Cache the content of path, returns the previous one
+func (d *Differ) swap(path, content string) (previous string, cached bool) {
+	if element := d.files[path]; element != nil {
+		file := element.Value.(*cachedFile)
+		previous, cached = file.content, true
+		d.size += int64(len(content)) - int64(len(file.content))
+		file.content = content
+		d.lru.MoveToFront(element)
+	} else {
+		d.files[path] = d.lru.PushFront(&cachedFile{path: path, content: content})
+		d.size += int64(len(content))
+	}
+	for d.size > d.opts.MaxCacheSize {
+		d.remove(d.lru.Back())
+	}
+	return
+}
+
+func (d *Differ) forget(path string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if element := d.files[path]; element != nil {
+		d.remove(element)
+	}
+}
+
+func (d *Differ) remove(element *list.Element) {
+	file := d.lru.Remove(element).(*cachedFile)
+	delete(d.files, file.path)
+	d.size -= int64(len(file.content))
+}
@@ -0,0 +1,157 @@
+package fswatcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	lines := func(from, to int) string {
+		var s strings.Builder
+		for i := from; i <= to; i++ {
+			s.WriteString(strings.Repeat("x", i) + "\n")
+		}
+		return s.String()
+	}
+
+	cases := []struct {
+		name     string
+		old, new string
+		context  int
+		expected string
+	}{
+		{"same", "a\nb\n", "a\nb\n", 3, ""},
+		{"created", "", "a\nb\n", 3, "@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"emptied", "a\n", "", 3, "@@ -1 +0,0 @@\n-a\n"},
+		{"changed", "a\nb\nc\n", "a\nB\nc\nd\n", 3, "@@ -1,3 +1,4 @@\n a\n-b\n+B\n c\n+d\n"},
+		{"no context", "a\nb\nc\n", "a\nB\nc\n", 0, "@@ -2 +2 @@\n-b\n+B\n"},
+		{
+			"no newline", "a\nb", "a\nb\n", 3,
+			"@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		{
+			"hunks", lines(1, 20), strings.Replace(strings.Replace(lines(1, 20), "xx\n", "2\n", 1), "xxxxxxxxxxxxxxxxxxx\n", "", 1), 2,
+			"@@ -1,4 +1,4 @@\n x\n-xx\n+2\n xxx\n xxxx\n" +
+				"@@ -17,4 +17,3 @@\n " + strings.Repeat("x", 17) + "\n " + strings.Repeat("x", 18) + "\n-" +
+				strings.Repeat("x", 19) + "\n " + strings.Repeat("x", 20) + "\n",
+		},
+		{
+			"merged hunks", lines(1, 6), strings.Replace(strings.Replace(lines(1, 6), "x\n", "1\n", 1), "xxxxxx\n", "6\n", 1), 2,
+			"@@ -1,6 +1,6 @@\n-x\n+1\n xx\n xxx\n xxxx\n xxxxx\n-xxxxxx\n+6\n",
+		},
+	}
+	for _, c := range cases {
+		diff := unifiedDiff("file", c.old, c.new, c.context)
+		if c.expected != "" {
+			c.expected = "--- file\n+++ file\n" + c.expected
+		}
+		if diff != c.expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", c.name, c.expected, diff)
+		}
+	}
+}
+
+// Applying the edit script to the old lines gives the new ones
+func TestDiffLines(t *testing.T) {
+	cases := [][2]string{
+		{"abcabba", "cbabac"},
+		{"", "abc"},
+		{"abc", ""},
+		{"aaaa", "aa"},
+		{"abcdefgh", "hgfedcba"},
+		{"xaxbxc", "axbxcx"},
+	}
+	for _, c := range cases {
+		a, b := strings.Split(c[0], ""), strings.Split(c[1], "")
+		edits := diffLines(a, b)
+		var old, new []string
+		changes := 0
+		for _, e := range edits {
+			if e.op != '+' {
+				old = append(old, e.line)
+			}
+			if e.op != '-' {
+				new = append(new, e.line)
+			}
+			if e.op != ' ' {
+				changes++
+			}
+		}
+		if strings.Join(old, "") != c[0] || strings.Join(new, "") != c[1] {
+			t.Errorf("%q -> %q: invalid edits %v", c[0], c[1], edits)
+		}
+		if c[0] == "abcabba" && changes != 5 {
+			t.Errorf("expected the shortest edit script, got %d changes", changes)
+		}
+	}
+}
+
+func TestDiffer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "differ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	conf := write("conf.yml", "a: 1\nb: 2\n")
+	write("binary", "a\x00b")
+
+	differ := NewDiffer(DiffOptions{MaxFileSize: 16})
+	if err := differ.Preload(dir); err != nil {
+		t.Fatal(err)
+	}
+	var diffs []string
+	handler := Chain(HandlerFunc(func(event Event) error {
+		diffs = append(diffs, event.Meta["diff"])
+		return nil
+	}), differ.Middleware)
+
+	write("conf.yml", "a: 1\nb: 3\n")
+	handler.Handle(Event{Op: Write, Path: conf, Meta: map[string]string{"cookie": "1"}})
+	// atomic save
+	tmp := write("conf.yml.tmp", "a: 2\nb: 3\n")
+	handler.Handle(Event{Op: Create, Path: tmp})
+	os.Rename(tmp, conf)
+	handler.Handle(Event{Op: Create, Path: conf, OldPath: tmp})
+	// too large, binary, or unchanged
+	write("conf.yml", strings.Repeat("c: 3\n", 4))
+	handler.Handle(Event{Op: Write, Path: conf})
+	handler.Handle(Event{Op: Write, Path: write("binary", "a\x00c")})
+	handler.Handle(Event{Op: Remove, Path: conf})
+
+	expected := []string{
+		"--- " + conf + "\n+++ " + conf + "\n@@ -1,2 +1,2 @@\n a: 1\n-b: 2\n+b: 3\n",
+		"",
+		"--- " + conf + "\n+++ " + conf + "\n@@ -1,2 +1,2 @@\n-a: 1\n+a: 2\n b: 3\n",
+		"", "", "",
+	}
+	if len(diffs) != len(expected) {
+		t.Fatalf("expected %d events, got %d", len(expected), len(diffs))
+	}
+	for i := range expected {
+		if diffs[i] != expected[i] {
+			t.Errorf("event %d: expected\n%s\ngot\n%s", i, expected[i], diffs[i])
+		}
+	}
+	if _, cached := differ.files[tmp]; cached || differ.size != 0 {
+		t.Errorf("expected an empty cache, got %d bytes", differ.size)
+	}
+
+	// eviction
+	small := NewDiffer(DiffOptions{MaxCacheSize: 10})
+	small.Update(write("a", "12345"))
+	small.Update(write("b", "12345"))
+	small.Update(write("c", "1"))
+	if _, cached := small.files[filepath.Join(dir, "a")]; cached || small.size != 6 {
+		t.Errorf("expected the least recently changed file to be evicted, got %d bytes", small.size)
+	}
+}
@@ -0,0 +1,111 @@
+package fswatcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Op describes a change of a file or folder
+type Op uint32
+
+const (
+	Create Op = 1 << iota
+	Write
+	Remove
+	Rename
+	// The followed path appeared again after it was removed, renamed or replaced, see WithFollow
+	Recreate
+	// A file opened for writing was closed (native backend only, see WithNativeBackend)
+	CloseWrite
+	// The metadata of a file changed: permissions, owner, timestamps... (native backend only)
+	Attrib
+	// The backend dropped events, the state of the watched folder must be read again (native backend only)
+	Overflow
+	// The file or folder was there when the watch started, see WithInitialScan
+	Existing
+	// The initial scan is complete, the path is the root, see WithInitialScan
+	Ready
+)
+
+var opNames = []struct {
+	op   Op
+	name string
+}{
+	{Create, "CREATE"},
+	{Write, "WRITE"},
+	{Remove, "REMOVE"},
+	{Rename, "RENAME"},
+	{Recreate, "RECREATE"},
+	{CloseWrite, "CLOSE_WRITE"},
+	{Attrib, "ATTRIB"},
+	{Overflow, "OVERFLOW"},
+	{Existing, "EXISTING"},
+	{Ready, "READY"},
+}
+
+func (op Op) String() string {
+	var names []string
+	for _, item := range opNames {
+		if op&item.op == item.op {
+			names = append(names, item.name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return strings.Join(names, "|")
+}
+
+func (op Op) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.String())
+}
+
+func (op *Op) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := ParseOp(s)
+	if err != nil {
+		return err
+	}
+	*op = parsed
+	return nil
+}
+
+// Parse the representation returned by Op.String, e.g. "CREATE" or "REMOVE|RENAME"
+func ParseOp(s string) (Op, error) {
+	var op Op
+	for _, name := range strings.Split(s, "|") {
+		found := false
+		for _, item := range opNames {
+			if strings.EqualFold(name, item.name) {
+				op |= item.op
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown op: %s", name)
+		}
+	}
+	return op, nil
+}
+
+// A change delivered by a DeepWatch
+type Event struct {
+	Op   Op     `json:"op"`
+	Path string `json:"path"`
+	// Previous path of a file moved to Path, set on its Create event when the backend can
+	// tell (native backend, when the move was seen by the same watcher or was paired in time)
+	OldPath string    `json:"old_path,omitempty"`
+	Time    time.Time `json:"time"`
+	// Additional information from the source of the event
+	Meta map[string]string `json:"meta,omitempty"`
+}
+
+func (event Event) String() string {
+	return event.Op.String() + " " + event.Path
+}
@@ -1,97 +1,519 @@
 package fswatcher
 
 import (
-	log "github.com/sirupsen/logrus"
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"time"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 // Listen for changes to files or directories.
-// When the target is a directory, all subfiles and subdirectories are recursively monitored (the file at initialization is not processed).
-// When the target is a file, only listen for changes to this file, and stop listening when the file is deleted.
+// When the target is a directory, all subfiles and subdirectories are recursively monitored (the files at initialization
+// are not reported, unless WithInitialScan).
+// When the target is a file, only listen for changes to this file, and stop listening when the file is deleted
+// (unless it is followed by name, see WithFollow).
 type DeepWatch struct {
-	callable    Callable
-	watcherList []Watcher
+	root     string
+	handler  Handler
+	registry *Registry
+	metrics  *watchMetrics
+	logger   Logger
+	recorder *Recorder
+	opts     options
+	// follow the target by name, only when it is a file
+	follow bool
+	// watches the nearest existing ancestor of a root which does not exist yet
+	waiter *Watcher
+	// pairs the moves between the watched folders
+	moves *moveTable
+	// the folders to watch and the events to deliver, see WithSparseWatch
+	sparse *sparseSet
+
+	mutex    sync.Mutex
+	watchers map[string]*Watcher
+	stopped  bool
+	done     chan struct{}
+	// closed when the tree is covered, see Ready
+	ready     chan struct{}
+	readyOnce sync.Once
+	progress  *progressReporter
+	// a token for each goroutine listing folders besides the caller, see WithWorkers
+	workers chan struct{}
+	// the paths not watched, see Errors
+	failures map[string]*PathError
+
+	// held for reading while delivering, for writing while replaying on Resume
+	delivery sync.RWMutex
+	paused   bool
+	pending  *pendingEvents
+	// the events received during the initial scan, see WithInitialScan
+	scanning bool
+	held     []Event
 }
 
-// Stop all watchers
-func (dw DeepWatch) Stop() {
-	for i := range dw.watcherList {
-		w := dw.watcherList[i]
+// Stop all watchers. Stop can be called any number of times, it does not wait for
+// the watchers to exit, see Stopped.
+func (dw *DeepWatch) Stop() {
+	dw.mutex.Lock()
+	defer dw.mutex.Unlock()
+	if dw.stopped {
+		return
+	}
+	dw.stopped = true
+
+	watchers := make([]*Watcher, 0, len(dw.watchers))
+	for _, w := range dw.watchers {
 		w.Stop()
+		watchers = append(watchers, w)
 	}
+	dw.watchers = make(map[string]*Watcher)
+	if dw.waiter != nil {
+		dw.waiter.Stop()
+		watchers = append(watchers, dw.waiter)
+		dw.waiter = nil
+	}
+
+	go func() {
+		for _, w := range watchers {
+			<-w.Stopped()
+		}
+		close(dw.done)
+	}()
+}
+
+// Stopped returns a channel closed when all watchers have exited after Stop
+func (dw *DeepWatch) Stopped() <-chan struct{} {
+	return dw.done
+}
+
+// Ready returns a channel closed when all the folders of the tree are watched: when Watch
+// returns, unless WithWorkers is given, or when the root is created with WithWaitForCreation
+func (dw *DeepWatch) Ready() <-chan struct{} {
+	return dw.ready
+}
+
+// Current metrics of the watch
+func (dw *DeepWatch) Stats() Stats {
+	return dw.metrics.snapshot()
+}
+
+// The registry holding the metrics of the watch, it serves them over HTTP in the Prometheus text format
+func (dw *DeepWatch) Registry() *Registry {
+	return dw.registry
+}
+
+// Start watch. With the default BestEffort policy, Watch succeeds even when folders of the
+// tree cannot be watched: they are only reported by DeepWatch.Errors, see WithWatchPolicy.
+func Watch(path string, callable Callable, opts ...Option) (dw *DeepWatch, err error) {
+	return Handle(path, CallableHandler(callable), opts...)
 }
 
-// Start watch
-func Watch(path string, callable Callable) (dw DeepWatch, err error) {
-	dw = DeepWatch{callable: callable}
-	dw.watcherList = make([]Watcher, 0)
+// Start watch, delivering the events to handler. With the default BestEffort policy, the
+// folders which cannot be watched are only reported by DeepWatch.Errors, as with Watch.
+func Handle(path string, handler Handler, opts ...Option) (dw *DeepWatch, err error) {
+	o := newOptions(opts)
+	path = filepath.Clean(path)
+	dw = &DeepWatch{
+		root:     path,
+		handler:  handler,
+		registry: o.registry,
+		logger:   o.logger,
+		recorder: o.recorder,
+		opts:     o,
+		moves:    newMoveTable(),
+		watchers: make(map[string]*Watcher),
+		done:     make(chan struct{}),
+		ready:    make(chan struct{}),
+		progress: newProgressReporter(o.progress),
+		workers:  make(chan struct{}, o.workers-1),
+		failures: make(map[string]*PathError),
+	}
+	if len(o.sparse) > 0 {
+		if dw.sparse, err = newSparseSet(o.sparse); err != nil {
+			return nil, err
+		}
+	}
+	if dw.registry == nil {
+		dw.registry = NewRegistry()
+	}
+	dw.metrics = newWatchMetrics(dw.registry, path)
 
 	fileInfo, err := os.Stat(path)
 	if err != nil {
+		if o.wait && os.IsNotExist(err) {
+			if err = dw.waitForRoot(); err == nil && o.policy == RetryFailed {
+				go dw.retry()
+			}
+		}
 		return
 	}
 
+	dw.scanning = o.scan
+	if o.policy == RetryFailed {
+		go dw.retry()
+	}
+	if o.workers > 1 {
+		go func() {
+			dw.start(fileInfo)
+			if o.scan {
+				dw.scan()
+			}
+		}()
+		return
+	}
+	dw.start(fileInfo)
+	if errs := dw.Errors(); errs != nil && o.policy == FailFast {
+		return nil, errs
+	}
+	if o.scan {
+		go dw.scan()
+	}
+	return
+}
+
+// Watch the root, which exists, then close Ready
+func (dw *DeepWatch) start(fileInfo os.FileInfo) {
 	if fileInfo.IsDir() {
-		dw.watchFolder(path)
+		dw.watchFolder(dw.root)
 	} else {
-		dw.watchPath(path)
+		dw.sparse = nil
+		dw.follow = dw.opts.follow
+		dw.watchPath(dw.root)
 	}
-	return
+	dw.progress.done()
+	dw.readyOnce.Do(func() {
+		close(dw.ready)
+	})
 }
 
-func (dw *DeepWatch) watchPath(path string) {
-	callable := dw.callable
+var errStopped = errors.New("watch stopped")
 
-	w := Watcher{
-		Path:     path,
-		Callable: callable,
+func (dw *DeepWatch) watchPath(path string) error {
+	w := &Watcher{
+		Path:    path,
+		handler: dw.handlerFor(path),
+		metrics: dw.metrics,
+		logger:  dw.logger,
+		follow:  dw.follow && path == dw.root,
+		native:  dw.opts.native,
+		moves:   dw.moves,
 	}
 
-	lock.Lock()
-	dw.watcherList = append(dw.watcherList, w)
-	lock.Unlock()
+	dw.mutex.Lock()
+	if dw.stopped {
+		dw.mutex.Unlock()
+		return errStopped
+	}
 
-	w.Watch()
-}
+	// the path was removed and created again before the old watcher noticed
+	if old := dw.watchers[path]; old != nil {
+		old.Stop()
+	}
+	dw.watchers[path] = w
 
-func (dw *DeepWatch) watchFolder(path string) (err error) {
-	dw.watchPath(path)
+	err := w.Watch()
+	if err != nil {
+		delete(dw.watchers, path)
+	} else {
+		delete(dw.failures, path)
+	}
+	dw.mutex.Unlock()
 
-	files, err := ioutil.ReadDir(path)
 	if err != nil {
+		dw.fail("watch", path, err)
+		return err
+	}
+	dw.progress.add(0, 1, 0)
+	return nil
+}
+
+// Stop and forget the watchers of path and everything below it
+func (dw *DeepWatch) unwatch(path string) {
+	dw.mutex.Lock()
+	defer dw.mutex.Unlock()
+
+	prefix := path + string(filepath.Separator)
+	for p, w := range dw.watchers {
+		if p == path || strings.HasPrefix(p, prefix) {
+			w.Stop()
+			delete(dw.watchers, p)
+		}
+	}
+	for p := range dw.failures {
+		if p == path || strings.HasPrefix(p, prefix) {
+			delete(dw.failures, p)
+		}
+	}
+}
+
+// Watch path and the folders below it, listed by the workers, see WithWorkers
+func (dw *DeepWatch) watchFolder(path string) {
+	if dw.sparse != nil {
+		dw.watchSparse(path)
 		return
 	}
+	var wg sync.WaitGroup
+	dw.walkFolder(path, &wg)
+	wg.Wait()
+}
 
-	for i := range files {
-		file := files[i]
+func (dw *DeepWatch) walkFolder(path string, wg *sync.WaitGroup) {
+	if !dw.withinDepth(path) || dw.hidden(path) {
+		return
+	}
+	if dw.watchPath(path) == errStopped {
+		return
+	}
+	files, err := dw.readDir(path)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		if !file.IsDir() {
+			continue
+		}
 		sub := filepath.Join(path, file.Name())
-		if file.IsDir() {
-			subWatchErr := dw.watchFolder(sub)
-			if subWatchErr != nil {
-				log.Errorf("Error: watch sub folder exception: %s", err)
-			}
-		} else {
-			log.Debugf("Ignore initial file: %s", sub)
+		select {
+		case dw.workers <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				dw.walkFolder(sub, wg)
+				<-dw.workers
+			}()
+		default:
+			dw.walkFolder(sub, wg)
 		}
 	}
+}
 
-	return nil
+// List the folder path, counting it in the progress
+func (dw *DeepWatch) readDir(path string) ([]os.FileInfo, error) {
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		dw.fail("list", path, err)
+	} else {
+		dw.progress.add(1, 0, 0)
+	}
+	return files, err
 }
 
-func (dw *DeepWatch) onCreateFunc() func(path string) {
-	return func(path string) {
-		fileInfo, err := os.Stat(path)
+// Watch path and the folders below it wanted by the sparse patterns, and their ancestors.
+// Returns whether path is watched.
+func (dw *DeepWatch) watchSparse(path string) bool {
+	if !dw.withinDepth(path) || dw.hidden(path) {
+		return false
+	}
+	watched := dw.watched(path)
+	if !watched && dw.sparse.wants(dw.rel(path)) {
+		dw.watchPath(path)
+		watched = true
+	}
+
+	files, err := dw.readDir(path)
+	if err != nil {
+		return watched
+	}
+	for _, file := range files {
+		if file.IsDir() && dw.watchSparse(filepath.Join(path, file.Name())) && !watched {
+			dw.watchPath(path)
+			watched = true
+		}
+	}
+	return watched
+}
+
+func (dw *DeepWatch) watched(path string) bool {
+	dw.mutex.Lock()
+	defer dw.mutex.Unlock()
+	_, watched := dw.watchers[path]
+	return watched
+}
+
+// The path relative to the root, with forward slashes
+func (dw *DeepWatch) rel(path string) string {
+	return relSlash(dw.root, path)
+}
+
+func relSlash(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Whether path is not deeper than the maximum depth, see WithMaxDepth
+func (dw *DeepWatch) withinDepth(path string) bool {
+	return withinDepth(dw.root, path, dw.opts.maxDepth)
+}
+
+func withinDepth(root, path string, maxDepth int) bool {
+	if maxDepth < 0 {
+		return true
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	depth := 0
+	if rel != "." {
+		depth = strings.Count(rel, string(filepath.Separator)) + 1
+	}
+	return depth <= maxDepth
+}
+
+// Whether path is below a hidden file or folder ignored by WithIgnoreHidden
+func (dw *DeepWatch) hidden(path string) bool {
+	return dw.opts.hidden && isHidden(dw.root, path)
+}
+
+func isHidden(root, path string) bool {
+	if path == root {
+		return false
+	}
+	for _, element := range strings.Split(relSlash(root, path), "/") {
+		if strings.HasPrefix(element, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch the folders below path which are not watched yet
+func (dw *DeepWatch) watchMissing(path string) {
+	if dw.sparse != nil {
+		dw.watchSparse(path)
+		return
+	}
+	filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
 		if err != nil {
-			log.Warnf("Get file stat failed: %s", path)
-		} else if fileInfo.IsDir() {
-			dw.watchFolder(path)
+			if info != nil && info.IsDir() {
+				dw.fail("list", p, err)
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if !dw.withinDepth(p) || dw.hidden(p) {
+			return filepath.SkipDir
 		}
+		if !dw.watched(p) {
+			dw.watchPath(p)
+		}
+		return nil
+	})
+}
+
+// The handler of the watcher of path: keeps the watcher set in sync with the tree, then
+// delivers the event to the handler
+func (dw *DeepWatch) handlerFor(path string) func(event Event) bool {
+	return func(event Event) bool {
+		switch event.Op {
+		case Create:
+			dw.onCreate(event)
+		case Remove, Rename:
+			dw.onGone(path, event)
+		case Overflow:
+			// folders may have been created without notice
+			if !dw.follow {
+				dw.watchMissing(path)
+			}
+			dw.deliver(event)
+		default:
+			dw.deliver(event)
+		}
+		return true
+	}
+}
+
+func (dw *DeepWatch) onCreate(event Event) {
+	fileInfo, err := os.Stat(event.Path)
+	if err != nil {
+		dw.logger.Warnf("Get file stat failed: %s", event.Path)
+	} else if fileInfo.IsDir() {
+		dw.watchFolder(event.Path)
+	}
 
-		dw.callable.doOnCreate(path)
+	dw.deliver(event)
+}
+
+func (dw *DeepWatch) onGone(watcherPath string, event Event) {
+	if dw.follow {
+		// the followed file is still watched through its folder
+		dw.deliver(event)
+		return
+	}
+	dw.unwatch(event.Path)
+	// a sub folder reports its own removal, which is reported by its parent as well
+	if event.Path == watcherPath && event.Path != dw.root {
+		return
+	}
+	dw.deliver(event)
+}
+
+// Pass event to the handler, or keep it aside during the initial scan or while paused
+func (dw *DeepWatch) deliver(event Event) {
+	if dw.excluded(event) {
+		dw.metrics.drop()
+		return
+	}
+	dw.mutex.Lock()
+	if dw.scanning {
+		dw.held = append(dw.held, event)
+		dw.mutex.Unlock()
+		return
+	}
+	dw.mutex.Unlock()
+	dw.send(event)
+}
+
+func (dw *DeepWatch) send(event Event) {
+	dw.delivery.RLock()
+	defer dw.delivery.RUnlock()
+
+	dw.mutex.Lock()
+	if dw.paused {
+		dw.pending.add(event)
+		dw.mutex.Unlock()
+		return
+	}
+	dw.mutex.Unlock()
+
+	dw.dispatch(event)
+}
+
+// Whether the event is filtered out by WithIgnoreHidden or by the sparse patterns, see WithSparseWatch
+func (dw *DeepWatch) excluded(event Event) bool {
+	if event.Op&Overflow != 0 || event.Path == dw.root {
+		return false
+	}
+	if dw.hidden(event.Path) {
+		return true
+	}
+	if dw.sparse == nil {
+		return false
+	}
+	return !dw.sparse.match(dw.rel(event.Path)) && (event.OldPath == "" || !dw.sparse.match(dw.rel(event.OldPath)))
+}
+
+func (dw *DeepWatch) dispatch(event Event) {
+	if dw.recorder != nil {
+		if err := dw.recorder.Record(event); err != nil {
+			dw.logger.Warnf("Record event failed: %s", err)
+		}
+	}
+	err := dw.handler.Handle(event)
+	if err == ErrUnhandled {
+		dw.metrics.drop()
+	} else if err != nil {
+		dw.metrics.handlerError()
+		dw.logger.Warnf("Handle %s failed: %s", event, err)
 	}
 }
 
@@ -149,7 +571,6 @@ func (trigger DelayTrigger) AsyncDo() {
 
 		case <-time.After(trigger.timeout):
 			if trigger.callback != nil {
-				log.Debugf("callback: %s", trigger.filePath)
 				trigger.mutex.Lock()
 				defer trigger.mutex.Unlock()
 				trigger.callback(trigger.filePath)
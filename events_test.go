@@ -2,42 +2,11 @@ package fswatcher
 
 import (
 	"testing"
-	"os"
 	"strings"
 	"time"
 	"sync"
 )
 
-func TestWatch(t *testing.T) {
-	root := ".test"
-	os.MkdirAll(root, os.ModePerm)
-	defer os.RemoveAll(root)
-
-	sub := root + "/sub"
-	callable := Callable{
-		OnCreate: func(filePath string) {
-			t.Logf("OnCreate: %s", filePath)
-			if !strings.HasPrefix(filePath, root) {
-				t.Errorf("OnCreate: Unmatched file path: %s", filePath)
-			}
-		},
-		OnRemove: func(filePath string) {
-			t.Logf("OnRemove: %s", filePath)
-			if !strings.HasPrefix(filePath, root) {
-				t.Errorf("OnRemove: Unmatched file path: %s", filePath)
-			}
-		},
-	}
-
-	dw, _ := Watch(root, callable)
-
-	f, _ := os.OpenFile(sub, os.O_CREATE|os.O_RDWR, 0777)
-	f.Close()
-	dw.Stop()
-	os.Remove(sub)
-	dw.Stop()
-}
-
 type MockCall struct {
 	p     string
 	done  bool
@@ -1,5 +1,7 @@
 package filesync
 
+import "github.com/raomuyang/fswatcher"
+
 type Access struct {
 	Endpoint        string `yaml:"endpoint"`
 	AccessKeyID     string `yaml:"access_key_id"`
@@ -13,3 +15,27 @@ type FileSync interface {
 	Put(localFile string, key string) (downloadURL string, err error)
 	Delete(key string) error
 }
+
+// Option configures a FileSync
+type Option func(opts *options)
+
+type options struct {
+	logger fswatcher.Logger
+}
+
+func newOptions(opts []Option) options {
+	o := options{logger: fswatcher.NopLogger}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Send the log output to logger, by default nothing is logged
+func WithLogger(logger fswatcher.Logger) Option {
+	return func(opts *options) {
+		if logger != nil {
+			opts.logger = logger
+		}
+	}
+}
@@ -2,22 +2,23 @@ package filesync
 
 import (
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
-	log "github.com/sirupsen/logrus"
+	"github.com/raomuyang/fswatcher"
 	"strings"
 )
 
 type OSSFileSync struct {
 	access Access
+	logger fswatcher.Logger
 }
 
 // 创建一个基于OSS文件同步工具
-func NewOSSFileSync(access Access) OSSFileSync {
-	ossfs := OSSFileSync{access: access}
+func NewOSSFileSync(access Access, opts ...Option) OSSFileSync {
+	ossfs := OSSFileSync{access: access, logger: newOptions(opts).logger}
 	return ossfs
 }
 
 func (ossfs OSSFileSync) Put(localFile string, key string) (downloadURL string, err error) {
-	log.Debugf("Put `%s` with key: `%s`", localFile, key)
+	ossfs.logger.Debugf("Put `%s` with key: `%s`", localFile, key)
 
 	client, err := ossfs.initOSSClient()
 	if err != nil {
@@ -44,7 +45,7 @@ func (ossfs OSSFileSync) Put(localFile string, key string) (downloadURL string,
 }
 
 func (ossfs OSSFileSync) Delete(key string) (err error) {
-	log.Infof("try to remove remote object: %s", key)
+	ossfs.logger.Infof("try to remove remote object: %s", key)
 	client, err := ossfs.initOSSClient()
 	if err != nil {
 		return
@@ -4,7 +4,7 @@ import (
 	"context"
 	"github.com/qiniu/api.v7/auth/qbox"
 	"github.com/qiniu/api.v7/storage"
-	log "github.com/sirupsen/logrus"
+	"github.com/raomuyang/fswatcher"
 	"strings"
 )
 
@@ -13,12 +13,14 @@ type QiniuFileSync struct {
 	mac           *qbox.Mac
 	cfg           storage.Config
 	bucketManager *storage.BucketManager
+	logger        fswatcher.Logger
 }
 
 // 创建一个基于七牛云的文件存储工具
-func NewQiniuFileSync(access Access) (qiniu QiniuFileSync) {
+func NewQiniuFileSync(access Access, opts ...Option) (qiniu QiniuFileSync) {
 
 	qiniu.access = access
+	qiniu.logger = newOptions(opts).logger
 
 	bucket := access.Bucket
 	endpoint := access.Endpoint
@@ -49,7 +51,7 @@ func NewQiniuFileSync(access Access) (qiniu QiniuFileSync) {
 
 func (qiniu QiniuFileSync) Put(localFile string, key string) (downloadURL string, err error) {
 
-	log.Debugf("Put `%s` with key: `%s`", localFile, key)
+	qiniu.logger.Debugf("Put `%s` with key: `%s`", localFile, key)
 
 	token, err := qiniu.initToken()
 
@@ -64,7 +66,7 @@ func (qiniu QiniuFileSync) Put(localFile string, key string) (downloadURL string
 }
 
 func (qiniu QiniuFileSync) Delete(key string) error {
-	log.Infof("try to remove remote object: %s", key)
+	qiniu.logger.Infof("try to remove remote object: %s", key)
 	return qiniu.bucketManager.Delete(qiniu.access.Bucket, key)
 }
 
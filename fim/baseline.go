@@ -0,0 +1,227 @@
+// Package fim is a file integrity monitor: it records a signed baseline of the files of a
+// folder, then reports the files added, removed, or whose content, permissions or owner
+// changed since the baseline.
+package fim
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The recorded state of a file or folder
+type Entry struct {
+	// Relative to the root of the baseline with forward slashes, "." for the root
+	Path string      `json:"path"`
+	Mode os.FileMode `json:"mode"`
+	// -1 where there are no numeric owners (Windows)
+	UID int `json:"uid"`
+	GID int `json:"gid"`
+	// Size and SHA-256 of the content of a regular file
+	Size int64  `json:"size,omitempty"`
+	Hash string `json:"hash,omitempty"`
+	// Target of a symbolic link
+	Link string `json:"link,omitempty"`
+}
+
+// The entries of a folder at a point in time
+type Baseline struct {
+	Root    string    `json:"root"`
+	Created time.Time `json:"created"`
+	// Sorted by path
+	Entries []Entry `json:"entries"`
+	// HMAC-SHA256 of the baseline without its signature, see Sign
+	Signature string `json:"signature,omitempty"`
+}
+
+// Returned when the signature of a baseline does not match its content
+var ErrSignature = errors.New("invalid baseline signature")
+
+// Record the entries of the folder at root, fails if one of them cannot be read. Only
+// WithExclude applies.
+func Scan(root string, opts ...Option) (*Baseline, error) {
+	o := newOptions(opts)
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	baseline := &Baseline{Root: root, Created: time.Now().UTC()}
+	failures := scan(root, ".", o.excluded(root), func(entry *Entry) {
+		baseline.Entries = append(baseline.Entries, *entry)
+	})
+	if err := failuresError(failures); err != nil {
+		return nil, err
+	}
+	sort.Slice(baseline.Entries, func(i, j int) bool {
+		return baseline.Entries[i].Path < baseline.Entries[j].Path
+	})
+	return baseline, nil
+}
+
+// Sign the baseline with key
+func (baseline *Baseline) Sign(key []byte) {
+	baseline.Signature = ""
+	baseline.Signature = hex.EncodeToString(baseline.mac(key))
+}
+
+// Check the signature of the baseline, returns ErrSignature if it does not match
+func (baseline *Baseline) Verify(key []byte) error {
+	signature, err := hex.DecodeString(baseline.Signature)
+	if err != nil || baseline.Signature == "" {
+		return ErrSignature
+	}
+	unsigned := *baseline
+	unsigned.Signature = ""
+	if !hmac.Equal(signature, unsigned.mac(key)) {
+		return ErrSignature
+	}
+	return nil
+}
+
+func (baseline *Baseline) mac(key []byte) []byte {
+	// the entries are sorted: the encoding is deterministic
+	data, _ := json.Marshal(baseline)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// Write the baseline to a file only readable by its owner
+func (baseline *Baseline) Save(path string) error {
+	data, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// Read a baseline saved by Save and check its signature
+func Load(path string, key []byte) (*Baseline, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	baseline := &Baseline{}
+	if err := json.Unmarshal(data, baseline); err != nil {
+		return nil, errors.Wrapf(err, "parse %s", path)
+	}
+	if err := baseline.Verify(key); err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+	return baseline, nil
+}
+
+// Call fn with the entries at and below rel in root, the excluded paths and the paths
+// missing or vanishing during the walk are skipped. Returns the entries which could not be read by relative path: the
+// files and links are passed to fn without their hash or target, the content of the folders
+// and the paths which could not be stat-ed are unknown.
+func scan(root, rel string, excludedPaths map[string]bool, fn func(entry *Entry)) map[string]error {
+	failures := make(map[string]error)
+	filepath.Walk(filepath.Join(root, filepath.FromSlash(rel)), func(path string, info os.FileInfo, err error) error {
+		if excluded(excludedPaths, relPath(root, path)) {
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info != nil {
+			// with the error of a folder which cannot be listed
+			entry, entryErr := newEntry(root, path, info)
+			fn(entry)
+			if err == nil {
+				err = entryErr
+			}
+		}
+		if err == nil || os.IsNotExist(err) {
+			return nil
+		}
+		failures[relPath(root, path)] = err
+		if info != nil && info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return failures
+}
+
+// Whether path is, or is below, one of the excluded paths
+func excluded(excludedPaths map[string]bool, path string) bool {
+	for rel := range excludedPaths {
+		if below(rel, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether path is, or is below, one of the entries which could not be read
+func unread(failures map[string]error, path string) bool {
+	for failed := range failures {
+		if below(failed, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// The error of the first entry which could not be read, nil if there is none
+func failuresError(failures map[string]error) error {
+	if len(failures) == 0 {
+		return nil
+	}
+	paths := make([]string, 0, len(failures))
+	for path := range failures {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	err := failures[paths[0]]
+	if len(paths) > 1 {
+		return errors.Wrapf(err, "%d entries not read, first", len(paths))
+	}
+	return err
+}
+
+// The entry of path, without its hash or link target along with the error if they
+// cannot be read
+func newEntry(root, path string, info os.FileInfo) (entry *Entry, err error) {
+	entry = &Entry{Path: relPath(root, path), Mode: info.Mode()}
+	entry.UID, entry.GID = owner(info)
+	switch {
+	case info.Mode().IsRegular():
+		entry.Size = info.Size()
+		entry.Hash, err = hash(path)
+	case info.Mode()&os.ModeSymlink != 0:
+		entry.Link, err = os.Readlink(path)
+	}
+	return entry, err
+}
+
+func relPath(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func hash(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,132 @@
+package fim
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// What differs from the baseline
+type Kind uint32
+
+const (
+	Added Kind = 1 << iota
+	Removed
+	// The content of a file, the target of a link, or the type of the entry changed
+	Content
+	// The permissions or the other mode bits changed
+	Mode
+	Owner
+)
+
+var kindNames = []struct {
+	kind Kind
+	name string
+}{
+	{Added, "ADDED"},
+	{Removed, "REMOVED"},
+	{Content, "CONTENT"},
+	{Mode, "MODE"},
+	{Owner, "OWNER"},
+}
+
+func (kind Kind) String() string {
+	var names []string
+	for _, item := range kindNames {
+		if kind&item.kind != 0 {
+			names = append(names, item.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+func (kind Kind) MarshalText() ([]byte, error) {
+	return []byte(kind.String()), nil
+}
+
+// A difference with the baseline
+type Change struct {
+	Kind Kind `json:"kind"`
+	// Absolute path of the entry
+	Path string `json:"path"`
+	// The entry in the baseline, nil when Added
+	Baseline *Entry `json:"baseline,omitempty"`
+	// The entry found, nil when Removed
+	Current *Entry `json:"current,omitempty"`
+}
+
+func (change Change) String() string {
+	return change.Kind.String() + " " + change.Path
+}
+
+// The differences between the baseline and the current entries of root, sorted by path.
+// The files which cannot be read are compared without their hash, and the content of the
+// folders which cannot be listed is not compared: the changes found are returned along with
+// the error. Only WithExclude applies.
+func Check(root string, baseline *Baseline, opts ...Option) ([]Change, error) {
+	o := newOptions(opts)
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	excludedPaths := o.excluded(root)
+	entries := make(map[string]*Entry)
+	for i := range baseline.Entries {
+		if path := baseline.Entries[i].Path; !excluded(excludedPaths, path) {
+			entries[path] = &baseline.Entries[i]
+		}
+	}
+	var changes []Change
+	failures := scan(root, ".", excludedPaths, func(entry *Entry) {
+		if kind := compare(entries[entry.Path], entry); kind != 0 {
+			changes = append(changes, newChange(root, kind, entries[entry.Path], entry))
+		}
+		delete(entries, entry.Path)
+	})
+	for _, entry := range entries {
+		if !unread(failures, entry.Path) {
+			changes = append(changes, newChange(root, Removed, entry, nil))
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, failuresError(failures)
+}
+
+func newChange(root string, kind Kind, baseline, current *Entry) Change {
+	path := baseline
+	if path == nil {
+		path = current
+	}
+	return Change{
+		Kind:     kind,
+		Path:     filepath.Join(root, filepath.FromSlash(path.Path)),
+		Baseline: baseline,
+		Current:  current,
+	}
+}
+
+// How current differs from baseline, either may be nil
+func compare(baseline, current *Entry) Kind {
+	switch {
+	case baseline == nil && current == nil:
+		return 0
+	case baseline == nil:
+		return Added
+	case current == nil:
+		return Removed
+	}
+	var kind Kind
+	if baseline.Mode.Type() != current.Mode.Type() || baseline.Size != current.Size ||
+		baseline.Hash != current.Hash || baseline.Link != current.Link {
+		kind |= Content
+	}
+	if baseline.Mode != current.Mode {
+		kind |= Mode
+	}
+	if baseline.UID != current.UID || baseline.GID != current.GID {
+		kind |= Owner
+	}
+	return kind
+}
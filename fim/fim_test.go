@@ -0,0 +1,217 @@
+package fim
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/raomuyang/fswatcher/fswatchertest"
+)
+
+var key = []byte("secret")
+
+func TestBaseline(t *testing.T) {
+	tree := fswatchertest.NewTree(t, "etc/", "etc/app.conf", "bin/")
+	tree.WriteFile("etc/app.conf", "port: 80\n")
+	baseline, err := Scan(tree.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(baseline.Entries) != 4 || baseline.Entries[0].Path != "." || baseline.Entries[2].Path != "etc" {
+		t.Fatalf("unexpected entries %+v", baseline.Entries)
+	}
+	conf := baseline.Entries[3]
+	if conf.Path != "etc/app.conf" || conf.Size != 9 || len(conf.Hash) != 64 {
+		t.Errorf("unexpected entry %+v", conf)
+	}
+
+	baseline.Sign(key)
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	if err := baseline.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Entries) != 4 || loaded.Entries[3] != conf {
+		t.Errorf("unexpected loaded entries %+v", loaded.Entries)
+	}
+	if _, err := Load(path, []byte("other")); err == nil {
+		t.Error("expected an error for another key")
+	}
+	loaded.Entries[3].Hash = "0"
+	if err := loaded.Verify(key); err != ErrSignature {
+		t.Errorf("expected ErrSignature for a tampered baseline, got %v", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tree := fswatchertest.NewTree(t, "etc/", "etc/app.conf", "etc/old.conf", "bin/")
+	baseline, err := Scan(tree.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree.WriteFile("etc/app.conf", "port: 8080\n")
+	tree.Remove("etc/old.conf")
+	tree.WriteFile("bin/backdoor", "")
+	if runtime.GOOS != "windows" {
+		os.Chmod(tree.Path("bin"), 0777)
+	}
+
+	changes, err := Check(tree.Root, baseline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"MODE bin", "ADDED bin/backdoor", "CONTENT etc/app.conf", "REMOVED etc/old.conf"}
+	if runtime.GOOS == "windows" {
+		expected = expected[1:]
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %q, got %v", expected, changes)
+	}
+	for i, change := range changes {
+		if s := describe(tree, change); s != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], s)
+		}
+	}
+}
+
+func TestCheck_Unreadable(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("needs permissions to be enforced")
+	}
+	tree := fswatchertest.NewTree(t, "etc/", "etc/secret", "etc/private/", "etc/private/key")
+	baseline, err := Scan(tree.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rel := range []string{"etc/secret", "etc/private"} {
+		if err := os.Chmod(tree.Path(rel), 0); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Chmod(tree.Path(rel), 0755)
+	}
+	if _, err := Scan(tree.Root); err == nil {
+		t.Error("expected Scan to fail")
+	}
+
+	changes, err := Check(tree.Root, baseline)
+	if err == nil {
+		t.Error("expected an error for the entries not read")
+	}
+	// the content of etc/private is unknown, not removed
+	expected := []string{"MODE etc/private", "CONTENT|MODE etc/secret"}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %q, got %v", expected, changes)
+	}
+	for i, change := range changes {
+		if s := describe(tree, change); s != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], s)
+		}
+	}
+
+	var reported []string
+	m, err := Watch(tree.Root, baseline, func(change Change) {
+		reported = append(reported, describe(tree, change))
+	}, WithInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Stop()
+	<-m.Stopped()
+	if len(reported) != len(expected) || reported[0] != expected[0] || reported[1] != expected[1] {
+		t.Errorf("expected the monitor to report %q, got %q", expected, reported)
+	}
+}
+
+// The kind and the relative path of change
+func describe(tree *fswatchertest.Tree, change Change) string {
+	rel, _ := filepath.Rel(tree.Root, change.Path)
+	return change.Kind.String() + " " + filepath.ToSlash(rel)
+}
+
+func TestMonitor(t *testing.T) {
+	tree := fswatchertest.NewTree(t, "etc/", "etc/app.conf", "var/")
+	tree.WriteFile("etc/app.conf", "port: 80\n")
+	baseline, err := Scan(tree.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// changed while the monitor was not running
+	tree.WriteFile("etc/extra.conf", "")
+
+	changes := make(chan Change, 16)
+	m, err := Watch(tree.Root, baseline, func(change Change) {
+		changes <- change
+	}, WithInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		m.Stop()
+		<-m.Stopped()
+	}()
+
+	// atomically, a write would report the intermediate states of the file
+	replace := func(rel, content string) {
+		tmp := filepath.Join(t.TempDir(), "tmp")
+		if err := ioutil.WriteFile(tmp, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, tree.Path(rel)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// in any order
+	expect := func(expected ...string) {
+		t.Helper()
+		pending := make(map[string]bool)
+		for _, e := range expected {
+			pending[e] = true
+		}
+		for len(pending) > 0 {
+			select {
+			case change := <-changes:
+				s := describe(tree, change)
+				if !pending[s] {
+					t.Errorf("unexpected change %s", s)
+				}
+				delete(pending, s)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timeout waiting for %v", pending)
+			}
+		}
+	}
+	expect("ADDED etc/extra.conf")
+
+	replace("etc/app.conf", "port: 8080\n")
+	expect("CONTENT etc/app.conf")
+	tree.Mkdir("var/cache")
+	replace("var/cache/payload", "x")
+	expect("ADDED var/cache", "ADDED var/cache/payload")
+	// the added entries removed are back to their baseline state
+	tree.Remove("var")
+	expect("REMOVED var")
+
+	// reverted, then changed again
+	replace("etc/app.conf", "port: 80\n")
+	time.Sleep(200 * time.Millisecond)
+	replace("etc/app.conf", "port: 8080\n")
+	expect("CONTENT etc/app.conf")
+
+	if runtime.GOOS != "windows" {
+		// attribute changes are only seen by the native backend or a verification
+		os.Chmod(tree.Path("etc/app.conf"), 0600)
+		m.Verify()
+		expect("CONTENT|MODE etc/app.conf")
+	}
+	select {
+	case change := <-changes:
+		t.Errorf("unexpected change %s", change)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,269 @@
+package fim
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/raomuyang/fswatcher"
+)
+
+// Option configures a Monitor, or a Scan or a Check
+type Option func(opts *options)
+
+type options struct {
+	interval     time.Duration
+	logger       fswatcher.Logger
+	watchOptions []fswatcher.Option
+	exclude      []string
+}
+
+func newOptions(opts []Option) options {
+	o := options{interval: time.Hour, logger: fswatcher.NopLogger}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// The relative paths of the excluded files or folders which lie in root
+func (o *options) excluded(root string) map[string]bool {
+	paths := make(map[string]bool, len(o.exclude))
+	for _, path := range o.exclude {
+		path, err := filepath.Abs(path)
+		if err != nil {
+			continue
+		}
+		if rel := relPath(root, path); rel != "." && rel != ".." && !strings.HasPrefix(rel, "../") {
+			paths[rel] = true
+		}
+	}
+	return paths
+}
+
+// Verify the whole folder at this interval, for the changes the watch could not see
+// (e.g. while the monitor was stopped, or in folders it could not watch). 1 hour by
+// default, 0 to disable.
+func WithInterval(interval time.Duration) Option {
+	return func(opts *options) {
+		opts.interval = interval
+	}
+}
+
+func WithLogger(logger fswatcher.Logger) Option {
+	return func(opts *options) {
+		if logger == nil {
+			logger = fswatcher.NopLogger
+		}
+		opts.logger = logger
+	}
+}
+
+// Ignore these files or folders, e.g. the baseline file when it lies in the folder: they are
+// neither recorded, nor reported when they change. Paths outside of the folder are ignored.
+func WithExclude(paths ...string) Option {
+	return func(opts *options) {
+		opts.exclude = append(opts.exclude, paths...)
+	}
+}
+
+// Options of the DeepWatch of the folder, e.g. fswatcher.WithNativeBackend
+func WithWatchOptions(opts ...fswatcher.Option) Option {
+	return func(o *options) {
+		o.watchOptions = append(o.watchOptions, opts...)
+	}
+}
+
+// Reports the differences with a baseline as the files change
+type Monitor struct {
+	root     string
+	baseline map[string]*Entry
+	excluded map[string]bool
+	onChange func(change Change)
+	logger   fswatcher.Logger
+	dw       *fswatcher.DeepWatch
+
+	// Held for a whole check: a check which scanned earlier does not apply its older state
+	// after a later one
+	mutex sync.Mutex
+	// The entries last seen when they differ from the baseline, nil when removed
+	seen map[string]*Entry
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// Watch root and call onChange with the differences with the baseline: once for the
+// differences found when the monitor starts, then each time an entry changes again.
+// An entry reverting to its baseline state is not reported.
+func Watch(root string, baseline *Baseline, onChange func(change Change), opts ...Option) (*Monitor, error) {
+	o := newOptions(opts)
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	m := &Monitor{
+		root:     root,
+		baseline: make(map[string]*Entry, len(baseline.Entries)),
+		excluded: o.excluded(root),
+		onChange: onChange,
+		logger:   o.logger,
+		seen:     make(map[string]*Entry),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	for i := range baseline.Entries {
+		if path := baseline.Entries[i].Path; !excluded(m.excluded, path) {
+			m.baseline[path] = &baseline.Entries[i]
+		}
+	}
+
+	m.dw, err = fswatcher.Handle(root, fswatcher.HandlerFunc(m.handle), append(o.watchOptions, fswatcher.WithLogger(o.logger))...)
+	if err != nil {
+		return nil, err
+	}
+	m.Verify()
+	go m.loop(o.interval)
+	return m, nil
+}
+
+func (m *Monitor) Stop() {
+	select {
+	case <-m.stop:
+	default:
+		close(m.stop)
+		m.dw.Stop()
+	}
+}
+
+// Stopped returns a channel closed when the monitor has exited after Stop
+func (m *Monitor) Stopped() <-chan struct{} {
+	return m.stopped
+}
+
+// Compare the whole folder with the baseline now
+func (m *Monitor) Verify() {
+	m.check(".")
+}
+
+func (m *Monitor) loop(interval time.Duration) {
+	defer close(m.stopped)
+	defer func() { <-m.dw.Stopped() }()
+	if interval <= 0 {
+		<-m.stop
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.Verify()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+func (m *Monitor) handle(event fswatcher.Event) error {
+	if event.Op&fswatcher.Overflow != 0 {
+		m.Verify()
+		return nil
+	}
+	for _, path := range []string{event.OldPath, event.Path} {
+		if path == "" {
+			continue
+		}
+		rel, err := filepath.Rel(m.root, path)
+		rel = filepath.ToSlash(rel)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			continue
+		}
+		m.check(rel)
+	}
+	return nil
+}
+
+// Compare the entries at and below rel with the baseline
+func (m *Monitor) check(rel string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	current := make(map[string]*Entry)
+	failures := scan(m.root, rel, m.excluded, func(entry *Entry) {
+		current[entry.Path] = entry
+	})
+	if err := failuresError(failures); err != nil {
+		m.logger.Warnf("FIM scan of %s incomplete: %s", rel, err)
+	}
+
+	if !isDir(current[rel]) && !isDir(m.baseline[rel]) && !isDir(m.seen[rel]) {
+		if current[rel] != nil || !unread(failures, rel) {
+			m.update(rel, current[rel])
+		}
+		return
+	}
+	paths := make(map[string]bool, len(current))
+	for path := range current {
+		paths[path] = true
+	}
+	// the entries gone
+	for path := range m.baseline {
+		if below(rel, path) {
+			paths[path] = true
+		}
+	}
+	for path := range m.seen {
+		if below(rel, path) {
+			paths[path] = true
+		}
+	}
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+	for _, path := range sorted {
+		if current[path] == nil && unread(failures, path) {
+			// not known to be removed
+			continue
+		}
+		m.update(path, current[path])
+	}
+}
+
+func (m *Monitor) update(path string, current *Entry) {
+	last, found := m.seen[path]
+	if !found {
+		last = m.baseline[path]
+	}
+	if same(last, current) {
+		return
+	}
+	kind := compare(m.baseline[path], current)
+	if kind == 0 {
+		delete(m.seen, path)
+		m.logger.Infof("FIM: %s reverted to its baseline", path)
+		return
+	}
+	m.seen[path] = current
+	change := newChange(m.root, kind, m.baseline[path], current)
+	m.logger.Warnf("FIM: %s", change)
+	m.onChange(change)
+}
+
+func same(a, b *Entry) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func isDir(entry *Entry) bool {
+	return entry != nil && entry.Mode.IsDir()
+}
+
+func below(rel, path string) bool {
+	return rel == "." || path == rel || strings.HasPrefix(path, rel+"/")
+}
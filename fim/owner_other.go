@@ -0,0 +1,10 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package fim
+
+import "os"
+
+func owner(info os.FileInfo) (uid, gid int) {
+	return -1, -1
+}
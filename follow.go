@@ -0,0 +1,96 @@
+package fswatcher
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// State of a path followed by name
+type followState struct {
+	path string
+	// the path currently exists
+	present bool
+	// the path existed at some point
+	existed bool
+	// how the path disappeared last: remove or rename
+	cause string
+}
+
+func newFollowState(path string) *followState {
+	state := &followState{path: filepath.Clean(path)}
+	if _, err := os.Stat(state.path); err == nil {
+		state.present = true
+		state.existed = true
+	}
+	return state
+}
+
+// Handle an event of the parent folder of the followed path.
+// Returns true when the parent folder itself is gone.
+func (watcher *Watcher) onFollowEvent(event backendEvent, state *followState) (gone bool) {
+	if event.extra&Overflow == Overflow {
+		watcher.logger.Warnf("Events lost: %s", state.path)
+		watcher.metrics.received(event)
+		if !watcher.emit(Event{Op: Overflow, Path: state.path}) {
+			watcher.metrics.drop()
+		}
+		return false
+	}
+	if event.Name == filepath.Dir(state.path) {
+		return event.Op&(fsnotify.Remove|fsnotify.Rename) != 0
+	}
+	if event.Name != state.path {
+		return false
+	}
+
+	watcher.logger.Debugf("event: %v", event.Event)
+	watcher.metrics.received(event)
+
+	start := time.Now()
+	delivered := false
+
+	if event.Op&fsnotify.Create == fsnotify.Create {
+		switch {
+		case !state.existed:
+			delivered = watcher.emit(watcher.moved(event, Create))
+		default:
+			// replaced while present (e.g. renamed over), or created again
+			cause := state.cause
+			if state.present {
+				cause = "replace"
+			}
+			watcher.logger.Infof("Recreate (%s): %s", cause, event.Name)
+			delivered = watcher.emit(Event{Op: Recreate, Path: event.Name})
+		}
+		state.present = true
+		state.existed = true
+	}
+
+	if event.Op&fsnotify.Write == fsnotify.Write {
+		delivered = watcher.emit(Event{Op: Write, Path: event.Name}) || delivered
+	}
+
+	if event.Op&fsnotify.Rename == fsnotify.Rename {
+		watcher.logger.Infof("Rename: %s", event.Name)
+		state.present = false
+		state.cause = "rename"
+		delivered = watcher.emit(watcher.moved(event, Rename)) || delivered
+	} else if event.Op&fsnotify.Remove == fsnotify.Remove {
+		watcher.logger.Infof("Remove: %s", event.Name)
+		state.present = false
+		state.cause = "remove"
+		delivered = watcher.emit(Event{Op: Remove, Path: event.Name}) || delivered
+	}
+
+	delivered = watcher.emitExtra(event) || delivered
+
+	if delivered {
+		watcher.metrics.observeSince(start)
+	} else {
+		watcher.metrics.drop()
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package fswatcher_test
+
+import (
+	"testing"
+
+	"github.com/raomuyang/fswatcher"
+	"github.com/raomuyang/fswatcher/fswatchertest"
+)
+
+func TestWatch_Follow(t *testing.T) {
+	tree := fswatchertest.NewTree(t, "app.log")
+	recorder := fswatchertest.NewRecorder(tree.Root)
+
+	dw, err := fswatcher.Watch(tree.Path("app.log"), recorder.Callable(), fswatcher.WithFollow())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dw.Stop()
+
+	tree.AppendFile("app.log", "1")
+	recorder.ExpectEvents(t, timeout, fswatchertest.Write("app.log"))
+
+	// rotation
+	tree.Rename("app.log", "app.log.1")
+	recorder.ExpectEvents(t, timeout, fswatchertest.Rename("app.log"))
+	tree.AppendFile("app.log.1", "ignored")
+	tree.AppendFile("app.log", "2")
+	recorder.ExpectEvents(t, timeout, fswatchertest.Recreate("app.log"), fswatchertest.Write("app.log"))
+
+	// removal
+	tree.Remove("app.log")
+	recorder.ExpectEvents(t, timeout, fswatchertest.Remove("app.log"))
+	tree.WriteFile("app.log", "")
+	recorder.ExpectEvents(t, timeout, fswatchertest.Recreate("app.log"))
+
+	// atomic replacement
+	tree.WriteFile("app.log.tmp", "3")
+	tree.Rename("app.log.tmp", "app.log")
+	recorder.ExpectEvents(t, timeout, fswatchertest.Exactly, fswatchertest.Recreate("app.log"))
+}
+
+func TestWatcher_Follow(t *testing.T) {
+	tree := fswatchertest.NewTree(t)
+	recorder := fswatchertest.NewRecorder(tree.Root)
+
+	watcher := &fswatcher.Watcher{Path: tree.Path("conf.yml"), Callable: recorder.Callable()}
+	if err := watcher.Watch(fswatcher.WithFollow()); err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Stop()
+
+	tree.WriteFile("conf.yml", "a: 1")
+	recorder.ExpectEvents(t, timeout, fswatchertest.Create("conf.yml"))
+	tree.Remove("conf.yml")
+	tree.WriteFile("conf.yml", "a: 2")
+	recorder.ExpectEvents(t, timeout, fswatchertest.Remove("conf.yml"), fswatchertest.Recreate("conf.yml"))
+}
@@ -0,0 +1,224 @@
+package fswatchertest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raomuyang/fswatcher"
+)
+
+// An argument of ExpectEvents: an expected event or an Order
+type Expectation interface {
+	apply(e *expectation)
+}
+
+// An expected event, Path is relative to the root of the Recorder
+type Expected struct {
+	Op   fswatcher.Op
+	Path string
+	// checked when not empty
+	OldPath string
+}
+
+func (expected Expected) String() string {
+	if expected.OldPath != "" {
+		return expected.Op.String() + " " + expected.Path + " from " + expected.OldPath
+	}
+	return expected.Op.String() + " " + expected.Path
+}
+
+func (expected Expected) apply(e *expectation) {
+	e.events = append(e.events, expected)
+}
+
+func (expected Expected) matches(event fswatcher.Event) bool {
+	return expected.Op == event.Op && expected.Path == event.Path &&
+		(expected.OldPath == "" || expected.OldPath == event.OldPath)
+}
+
+func Create(path string) Expected {
+	return Expected{Op: fswatcher.Create, Path: path}
+}
+
+func Write(path string) Expected {
+	return Expected{Op: fswatcher.Write, Path: path}
+}
+
+func Remove(path string) Expected {
+	return Expected{Op: fswatcher.Remove, Path: path}
+}
+
+func Rename(path string) Expected {
+	return Expected{Op: fswatcher.Rename, Path: path}
+}
+
+func Recreate(path string) Expected {
+	return Expected{Op: fswatcher.Recreate, Path: path}
+}
+
+func CloseWrite(path string) Expected {
+	return Expected{Op: fswatcher.CloseWrite, Path: path}
+}
+
+func Attrib(path string) Expected {
+	return Expected{Op: fswatcher.Attrib, Path: path}
+}
+
+func Existing(path string) Expected {
+	return Expected{Op: fswatcher.Existing, Path: path}
+}
+
+// The end of the initial scan, see fswatcher.WithInitialScan
+func Ready() Expected {
+	return Expected{Op: fswatcher.Ready, Path: "."}
+}
+
+// The Create event of a file moved from oldPath to path, see fswatcher.WithNativeBackend
+func Moved(oldPath, path string) Expected {
+	return Expected{Op: fswatcher.Create, Path: path, OldPath: oldPath}
+}
+
+// How the expected events are matched against the recorded ones
+type Order int
+
+const (
+	// The expected events are received in the given order, other events may come in between
+	InOrder Order = iota
+	// The expected events are received in any order, other events may come in between
+	AnyOrder
+	// Exactly the expected events are received, in the given order
+	Exactly
+)
+
+func (order Order) apply(e *expectation) {
+	e.order = order
+}
+
+type expectation struct {
+	order  Order
+	events []Expected
+}
+
+// Wait up to timeout for the expected events, and fail the test if they are not received.
+// Only the events received after those matched by the previous call are considered.
+// The order of the events is checked according to an Order given among the expectations,
+// InOrder by default.
+func (recorder *Recorder) ExpectEvents(t testing.TB, timeout time.Duration, expectations ...Expectation) {
+	t.Helper()
+	e := &expectation{}
+	for _, item := range expectations {
+		item.apply(e)
+	}
+
+	deadline := time.After(timeout)
+	for {
+		recorder.mutex.Lock()
+		events := recorder.events[recorder.cursor:]
+		end, ok, failed := e.match(events)
+		changed := recorder.changed
+		if ok {
+			recorder.cursor += end
+		}
+		recorder.mutex.Unlock()
+
+		if ok {
+			return
+		}
+		if failed {
+			t.Errorf("unexpected events\nexpected: %s\nreceived: %s", e, formatEvents(events))
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			t.Errorf("timeout after %s waiting for events\nexpected: %s\nreceived: %s",
+				timeout, e, formatEvents(events))
+			return
+		}
+	}
+}
+
+// Wait for within and fail the test if any event is received after those already matched
+func (recorder *Recorder) ExpectNoEvents(t testing.TB, within time.Duration) {
+	t.Helper()
+	<-time.After(within)
+
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	if events := recorder.events[recorder.cursor:]; len(events) > 0 {
+		t.Errorf("unexpected events: %s", formatEvents(events))
+	}
+}
+
+// Match the events, returns the number of events consumed when they match, failed when
+// no further event can make them match
+func (e *expectation) match(events []fswatcher.Event) (end int, ok bool, failed bool) {
+	switch e.order {
+	case Exactly:
+		for i, event := range events {
+			if i >= len(e.events) || !e.events[i].matches(event) {
+				return 0, false, true
+			}
+		}
+		if len(events) == len(e.events) {
+			return len(events), true, false
+		}
+		return 0, false, false
+
+	case AnyOrder:
+		matched := make([]bool, len(events))
+		for _, expected := range e.events {
+			found := false
+			for i, event := range events {
+				if !matched[i] && expected.matches(event) {
+					matched[i] = true
+					found = true
+					if i+1 > end {
+						end = i + 1
+					}
+					break
+				}
+			}
+			if !found {
+				return 0, false, false
+			}
+		}
+		return end, true, false
+
+	default:
+		next := 0
+		for i, event := range events {
+			if next == len(e.events) {
+				break
+			}
+			if e.events[next].matches(event) {
+				next++
+				end = i + 1
+			}
+		}
+		if next == len(e.events) {
+			return end, true, false
+		}
+		return 0, false, false
+	}
+}
+
+func (e *expectation) String() string {
+	items := make([]string, len(e.events))
+	for i, expected := range e.events {
+		items[i] = expected.String()
+	}
+	names := map[Order]string{InOrder: "in order", AnyOrder: "any order", Exactly: "exactly"}
+	return fmt.Sprintf("[%s] (%s)", strings.Join(items, ", "), names[e.order])
+}
+
+func formatEvents(events []fswatcher.Event) string {
+	items := make([]string, len(events))
+	for i, event := range events {
+		items[i] = event.String()
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
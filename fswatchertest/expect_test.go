@@ -0,0 +1,69 @@
+package fswatchertest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/raomuyang/fswatcher"
+)
+
+type fakeT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func record(recorder *Recorder, op fswatcher.Op, path string) {
+	recorder.Record(fswatcher.Event{Op: op, Path: path})
+}
+
+func TestExpectEvents(t *testing.T) {
+	recorder := NewRecorder("/root")
+	record(recorder, fswatcher.Create, "/root/a/b.txt")
+	record(recorder, fswatcher.Create, "/root/c")
+	record(recorder, fswatcher.Write, "/root/a/b.txt")
+
+	recorder.ExpectEvents(t, time.Second, Create("a/b.txt"), Write("a/b.txt"))
+	recorder.ExpectNoEvents(t, 10*time.Millisecond)
+
+	go func() {
+		<-time.After(50 * time.Millisecond)
+		record(recorder, fswatcher.Remove, "/root/c")
+		record(recorder, fswatcher.Remove, "/root/a/b.txt")
+	}()
+	recorder.ExpectEvents(t, time.Second, AnyOrder, Remove("a/b.txt"), Remove("c"))
+}
+
+func TestExpectEvents_Failures(t *testing.T) {
+	recorder := NewRecorder("/root")
+	record(recorder, fswatcher.Write, "/root/a")
+	record(recorder, fswatcher.Create, "/root/a")
+
+	cases := []struct {
+		name         string
+		expectations []Expectation
+	}{
+		{"order", []Expectation{Create("a"), Write("a")}},
+		{"missing", []Expectation{AnyOrder, Create("a"), Remove("a")}},
+		{"exactly", []Expectation{Exactly, Write("a")}},
+	}
+	for _, c := range cases {
+		fake := &fakeT{TB: t}
+		recorder.ExpectEvents(fake, 20*time.Millisecond, c.expectations...)
+		if len(fake.errors) != 1 {
+			t.Errorf("%s: expected a failure, got %v", c.name, fake.errors)
+		}
+	}
+
+	fake := &fakeT{TB: t}
+	recorder.ExpectNoEvents(fake, time.Millisecond)
+	if len(fake.errors) != 1 {
+		t.Errorf("expected unexpected events, got %v", fake.errors)
+	}
+}
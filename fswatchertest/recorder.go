@@ -0,0 +1,85 @@
+package fswatchertest
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/raomuyang/fswatcher"
+)
+
+// Recorder keeps the events it receives, to be checked with ExpectEvents.
+// Paths under root are recorded relative to it, with forward slashes.
+type Recorder struct {
+	root    string
+	mutex   sync.Mutex
+	events  []fswatcher.Event
+	cursor  int
+	changed chan struct{}
+}
+
+func NewRecorder(root string) *Recorder {
+	return &Recorder{root: filepath.Clean(root), changed: make(chan struct{})}
+}
+
+// A Callable recording every event
+func (recorder *Recorder) Callable() fswatcher.Callable {
+	record := func(op fswatcher.Op) func(string) {
+		return func(filePath string) {
+			recorder.Record(fswatcher.Event{Op: op, Path: filePath, Time: time.Now()})
+		}
+	}
+	return fswatcher.Callable{
+		OnCreate:   record(fswatcher.Create),
+		OnWrite:    record(fswatcher.Write),
+		OnRemove:   record(fswatcher.Remove),
+		OnRename:   record(fswatcher.Rename),
+		OnRecreate: record(fswatcher.Recreate),
+		OnExisting: record(fswatcher.Existing),
+		OnReady:    record(fswatcher.Ready),
+	}
+}
+
+// Record the event, a Recorder is a fswatcher.Handler as well
+func (recorder *Recorder) Handle(event fswatcher.Event) error {
+	recorder.Record(event)
+	return nil
+}
+
+// Add an event
+func (recorder *Recorder) Record(event fswatcher.Event) {
+	event.Path = recorder.rel(event.Path)
+	if event.OldPath != "" {
+		event.OldPath = recorder.rel(event.OldPath)
+	}
+
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	recorder.events = append(recorder.events, event)
+	close(recorder.changed)
+	recorder.changed = make(chan struct{})
+}
+
+// All events recorded so far
+func (recorder *Recorder) Events() []fswatcher.Event {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	return append([]fswatcher.Event(nil), recorder.events...)
+}
+
+// Forget all events
+func (recorder *Recorder) Reset() {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	recorder.events = nil
+	recorder.cursor = 0
+}
+
+func (recorder *Recorder) rel(path string) string {
+	rel, err := filepath.Rel(recorder.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
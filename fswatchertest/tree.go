@@ -0,0 +1,97 @@
+package fswatchertest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A temporary folder to run a watcher on, removed when the test ends.
+// All paths given to its methods are relative to Root and use forward slashes.
+type Tree struct {
+	Root string
+	t    testing.TB
+}
+
+// Create a temporary tree with the given entries, an entry ending with "/" is a folder,
+// any other entry an empty file
+func NewTree(t testing.TB, entries ...string) *Tree {
+	t.Helper()
+	root, err := ioutil.TempDir("", "fswatchertest")
+	if err != nil {
+		t.Fatalf("create temp dir: %s", err)
+	}
+	// resolve symlinks (e.g. /tmp on macOS) so that paths match the reported events
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(root)
+	})
+
+	tree := &Tree{Root: root, t: t}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry, "/") {
+			tree.Mkdir(entry)
+		} else {
+			tree.WriteFile(entry, "")
+		}
+	}
+	return tree
+}
+
+// Absolute path of rel
+func (tree *Tree) Path(rel string) string {
+	return filepath.Join(tree.Root, filepath.FromSlash(rel))
+}
+
+// Create the folder rel and its parents
+func (tree *Tree) Mkdir(rel string) {
+	tree.t.Helper()
+	if err := os.MkdirAll(tree.Path(rel), os.ModePerm); err != nil {
+		tree.t.Fatalf("mkdir %s: %s", rel, err)
+	}
+}
+
+// Create or truncate the file rel with content, parent folders are created as needed
+func (tree *Tree) WriteFile(rel, content string) {
+	tree.t.Helper()
+	path := tree.Path(rel)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		tree.t.Fatalf("mkdir %s: %s", filepath.Dir(rel), err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		tree.t.Fatalf("write %s: %s", rel, err)
+	}
+}
+
+// Append content to the file rel
+func (tree *Tree) AppendFile(rel, content string) {
+	tree.t.Helper()
+	f, err := os.OpenFile(tree.Path(rel), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		tree.t.Fatalf("open %s: %s", rel, err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		tree.t.Fatalf("append %s: %s", rel, err)
+	}
+}
+
+// Remove the file or folder rel with everything below it
+func (tree *Tree) Remove(rel string) {
+	tree.t.Helper()
+	if err := os.RemoveAll(tree.Path(rel)); err != nil {
+		tree.t.Fatalf("remove %s: %s", rel, err)
+	}
+}
+
+// Rename from to to
+func (tree *Tree) Rename(from, to string) {
+	tree.t.Helper()
+	if err := os.Rename(tree.Path(from), tree.Path(to)); err != nil {
+		tree.t.Fatalf("rename %s to %s: %s", from, to, err)
+	}
+}
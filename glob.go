@@ -0,0 +1,119 @@
+package fswatcher
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A compiled path pattern, see Mux for the syntax
+type glob struct {
+	pattern string
+	re      *regexp.Regexp
+	// number of literal characters, the more the more specific the pattern
+	literals    int
+	stars       int
+	doubleStars int
+}
+
+func compileGlob(pattern string) (*glob, error) {
+	g := &glob{pattern: pattern}
+	expr := &strings.Builder{}
+	expr.WriteString("^")
+
+	depth := 0
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				g.doubleStars++
+				atStart := i == 0 || pattern[i-1] == '/'
+				i++
+				if atStart && i+1 < len(pattern) && pattern[i+1] == '/' {
+					// "**/": zero or more path elements
+					i++
+					expr.WriteString("(?:.*/)?")
+				} else if i > 1 && pattern[i-2] == '/' && i+1 == len(pattern) {
+					// trailing "/**": the folder itself or anything below
+					s := expr.String()
+					expr.Reset()
+					expr.WriteString(strings.TrimSuffix(s, "/"))
+					expr.WriteString("(?:/.*)?")
+				} else {
+					expr.WriteString(".*")
+				}
+			} else {
+				g.stars++
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			g.stars++
+			expr.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid pattern %q: unterminated [", pattern)
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			g.stars++
+			expr.WriteString("[" + class + "]")
+			i += end + 1
+		case '{':
+			depth++
+			expr.WriteString("(?:")
+		case '}':
+			if depth == 0 {
+				return nil, fmt.Errorf("invalid pattern %q: unexpected }", pattern)
+			}
+			depth--
+			expr.WriteString(")")
+		case ',':
+			if depth > 0 {
+				expr.WriteString("|")
+			} else {
+				g.literals++
+				expr.WriteString(",")
+			}
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			g.literals++
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			g.literals++
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	if depth > 0 {
+		return nil, fmt.Errorf("invalid pattern %q: unterminated {", pattern)
+	}
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %s", pattern, err)
+	}
+	g.re = re
+	return g, nil
+}
+
+// Whether path (relative, with forward slashes) matches the pattern
+func (g *glob) match(path string) bool {
+	return g.re.MatchString(path)
+}
+
+// Whether g is more specific than other: more literal characters, then fewer **, then fewer wildcards
+func (g *glob) moreSpecific(other *glob) bool {
+	if g.literals != other.literals {
+		return g.literals > other.literals
+	}
+	if g.doubleStars != other.doubleStars {
+		return g.doubleStars < other.doubleStars
+	}
+	return g.stars < other.stars
+}
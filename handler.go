@@ -0,0 +1,170 @@
+package fswatcher
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Handler responds to the events of a DeepWatch, see Handle
+type Handler interface {
+	Handle(event Event) error
+}
+
+// An ordinary function used as a Handler
+type HandlerFunc func(event Event) error
+
+func (fn HandlerFunc) Handle(event Event) error {
+	return fn(event)
+}
+
+// Returned by a handler ignoring the event, e.g. the handler of a Callable when there is no
+// function for the operation. The event is counted as dropped instead of failed.
+var ErrUnhandled = errors.New("unhandled operation")
+
+type callableHandler struct {
+	callable Callable
+}
+
+// A Handler calling the function of callable corresponding to the operation of the event
+func CallableHandler(callable Callable) Handler {
+	return callableHandler{callable: callable}
+}
+
+func (h callableHandler) Handle(event Event) error {
+	if !h.callable.dispatch(event) {
+		return ErrUnhandled
+	}
+	return nil
+}
+
+// Middleware wraps a Handler to add behavior before or after it
+type Middleware func(next Handler) Handler
+
+// Wrap handler with middlewares, the first middleware is the outermost one
+func Chain(handler Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// Only pass the events accepted by accept, the others are ErrUnhandled
+func Filter(accept func(event Event) bool) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(event Event) error {
+			if !accept(event) {
+				return ErrUnhandled
+			}
+			return next.Handle(event)
+		})
+	}
+}
+
+// Log every event at debug level, and the errors returned by the handler
+func Logging(logger Logger) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(event Event) error {
+			logger.Debugf("event: %s", event)
+			err := next.Handle(event)
+			if err != nil && err != ErrUnhandled {
+				logger.Warnf("Handle %s failed: %s", event, err)
+			}
+			return err
+		})
+	}
+}
+
+// Turn a panic of the handler into an error
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(event Event) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("panic handling %s: %v", event, r)
+				}
+			}()
+			return next.Handle(event)
+		})
+	}
+}
+
+// Call the handler again when it fails, up to attempts calls in total. The wait between
+// two calls starts at backoff and doubles after each failure.
+func Retry(attempts int, backoff time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(event Event) error {
+			wait := backoff
+			var err error
+			for i := 0; i < attempts || i == 0; i++ {
+				if i > 0 {
+					time.Sleep(wait)
+					wait *= 2
+				}
+				err = next.Handle(event)
+				if err == nil || err == ErrUnhandled {
+					return err
+				}
+			}
+			return err
+		})
+	}
+}
+
+// Hold the events of a path until it has not changed for delay, then pass on its net changes
+// (merged like the events replayed by Resume). The handler is called from a timer goroutine,
+// so its errors cannot be returned: wrap it with Logging to see them.
+func Debounce(delay time.Duration) Middleware {
+	return func(next Handler) Handler {
+		d := &debouncer{next: next, delay: delay, pending: make(map[string]*debounced)}
+		return HandlerFunc(d.handle)
+	}
+}
+
+type debouncer struct {
+	next    Handler
+	delay   time.Duration
+	mutex   sync.Mutex
+	pending map[string]*debounced
+}
+
+type debounced struct {
+	events []Event
+	timer  *time.Timer
+}
+
+func (d *debouncer) handle(event Event) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	p := d.pending[event.Path]
+	if p == nil {
+		p = &debounced{}
+		d.pending[event.Path] = p
+		path := event.Path
+		p.timer = time.AfterFunc(d.delay, func() {
+			d.fire(path, p)
+		})
+	} else {
+		p.timer.Reset(d.delay)
+	}
+	p.events = coalesce(p.events, event)
+	return nil
+}
+
+func (d *debouncer) fire(path string, p *debounced) {
+	d.mutex.Lock()
+	if d.pending[path] != p {
+		d.mutex.Unlock()
+		return
+	}
+	delete(d.pending, path)
+	events := p.events
+	d.mutex.Unlock()
+
+	for _, event := range events {
+		d.next.Handle(event)
+	}
+}
@@ -0,0 +1,144 @@
+package fswatcher
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+type handled struct {
+	mutex  sync.Mutex
+	events []string
+}
+
+func (h *handled) Handle(event Event) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.events = append(h.events, event.String())
+	return nil
+}
+
+func (h *handled) get() []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return append([]string(nil), h.events...)
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return HandlerFunc(func(event Event) error {
+				order = append(order, name)
+				return next.Handle(event)
+			})
+		}
+	}
+	h := &handled{}
+	Chain(h, mark("outer"), mark("inner")).Handle(Event{Op: Create, Path: "a"})
+	if !reflect.DeepEqual(order, []string{"outer", "inner"}) {
+		t.Errorf("unexpected order: %v", order)
+	}
+	if !reflect.DeepEqual(h.get(), []string{"CREATE a"}) {
+		t.Errorf("unexpected events: %v", h.get())
+	}
+}
+
+func TestFilter(t *testing.T) {
+	h := &handled{}
+	filtered := Chain(h, Filter(func(event Event) bool {
+		return event.Op != Write
+	}))
+	filtered.Handle(Event{Op: Write, Path: "a"})
+	filtered.Handle(Event{Op: Remove, Path: "a"})
+	if !reflect.DeepEqual(h.get(), []string{"REMOVE a"}) {
+		t.Errorf("unexpected events: %v", h.get())
+	}
+}
+
+func TestRecoverRetry(t *testing.T) {
+	calls := 0
+	flaky := HandlerFunc(func(event Event) error {
+		calls++
+		switch calls {
+		case 1:
+			panic("boom")
+		case 2:
+			return errors.New("failed")
+		}
+		return nil
+	})
+	err := Chain(flaky, Retry(3, time.Millisecond), Recover()).Handle(Event{Op: Create, Path: "a"})
+	if err != nil || calls != 3 {
+		t.Errorf("expected success after 3 calls, got %v after %d", err, calls)
+	}
+
+	calls = 0
+	err = Chain(flaky, Retry(2, time.Millisecond), Recover()).Handle(Event{Op: Create, Path: "a"})
+	if err == nil || calls != 2 {
+		t.Errorf("expected failure after 2 calls, got %v after %d", err, calls)
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	h := &handled{}
+	debounced := Chain(h, Debounce(100*time.Millisecond))
+	debounced.Handle(Event{Op: Create, Path: "a"})
+	debounced.Handle(Event{Op: Write, Path: "a"})
+	debounced.Handle(Event{Op: Write, Path: "b"})
+	<-time.After(60 * time.Millisecond)
+	debounced.Handle(Event{Op: Write, Path: "a"})
+	if events := h.get(); len(events) > 0 {
+		t.Errorf("events not delayed: %v", events)
+	}
+
+	<-time.After(80 * time.Millisecond)
+	if events := h.get(); !reflect.DeepEqual(events, []string{"WRITE b"}) {
+		t.Errorf("unexpected events: %v", events)
+	}
+	<-time.After(80 * time.Millisecond)
+	if events := h.get(); !reflect.DeepEqual(events, []string{"WRITE b", "CREATE a"}) {
+		t.Errorf("unexpected events: %v", events)
+	}
+}
+
+func TestDebounce_Native(t *testing.T) {
+	h := &handled{}
+	debounced := Chain(h, Debounce(50*time.Millisecond))
+	for _, event := range []Event{
+		{Op: Create, Path: "a"},
+		{Op: Write, Path: "a"},
+		{Op: CloseWrite, Path: "a"},
+		{Op: Attrib, Path: "a"},
+		{Op: Remove, Path: "a"},
+		{Op: Write, Path: "b"},
+		{Op: CloseWrite, Path: "b"},
+		{Op: Attrib, Path: "b"},
+		{Op: Attrib, Path: "c"},
+	} {
+		debounced.Handle(event)
+	}
+
+	<-time.After(150 * time.Millisecond)
+	events := h.get()
+	sort.Strings(events)
+	if !reflect.DeepEqual(events, []string{"ATTRIB c", "CLOSE_WRITE b"}) {
+		t.Errorf("unexpected events: %v", events)
+	}
+}
+
+func TestCallableHandler(t *testing.T) {
+	created := ""
+	h := CallableHandler(Callable{OnCreate: func(filePath string) {
+		created = filePath
+	}})
+	if err := h.Handle(Event{Op: Create, Path: "a"}); err != nil || created != "a" {
+		t.Errorf("unexpected result: %v %s", err, created)
+	}
+	if err := h.Handle(Event{Op: Write, Path: "a"}); err != ErrUnhandled {
+		t.Errorf("expected unhandled, got %v", err)
+	}
+}
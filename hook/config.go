@@ -0,0 +1,69 @@
+package hook
+
+import (
+	"io/ioutil"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// The hooks of a watched folder, usually read from YAML:
+//
+//	hooks:
+//	  - name: thumbnails
+//	    paths: ["assets/**/*.{png,jpg}"]
+//	    ops: [create, write]
+//	    debounce: 500ms
+//	    command: [convert, "{{.Path}}", -resize, 200x200, "{{.Path}}.thumb.png"]
+//	    concurrency: 2
+//	    queue: 100
+//	    timeout: 1m
+//	  - name: docs
+//	    paths: ["docs/**"]
+//	    shell: make docs
+//	    env:
+//	      CHANGED: "{{.Rel}}"
+type Config struct {
+	Hooks []Rule `yaml:"hooks"`
+}
+
+// A command to run when a file changes
+type Rule struct {
+	Name string `yaml:"name"`
+	// Glob patterns relative to the watched folder, see fswatcher.Mux. Every path by default.
+	Paths []string `yaml:"paths"`
+	// Operations to react to, e.g. create, write, remove, rename. Every operation by default.
+	Ops []string `yaml:"ops"`
+	// Wait for the changes of a path to settle for this duration before running
+	Debounce time.Duration `yaml:"debounce"`
+	// The command and its arguments, run without a shell
+	Command []string `yaml:"command"`
+	// Or a command line run by the shell (sh -c, cmd /C on Windows). Prefer Command or the
+	// environment variables to templates in a command line: paths may contain any character.
+	Shell string `yaml:"shell"`
+	// Additional environment variables
+	Env map[string]string `yaml:"env"`
+	// Working directory, the watched folder by default
+	Dir string `yaml:"dir"`
+	// Maximum number of commands of the rule running at once, 1 by default
+	Concurrency int `yaml:"concurrency"`
+	// Maximum number of events waiting for a command of the rule, 1000 by default. The events
+	// arriving while the queue is full are dropped, see Engine.Dropped.
+	Queue int `yaml:"queue"`
+	// Kill the command and the processes it started after this duration, no limit by default
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Read a YAML configuration file
+func LoadConfig(path string) (config Config, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	err = yaml.UnmarshalStrict(data, &config)
+	if err != nil {
+		err = errors.Wrapf(err, "parse %s", path)
+	}
+	return
+}
@@ -0,0 +1,378 @@
+package hook
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/raomuyang/fswatcher"
+)
+
+// Option configures an Engine
+type Option func(opts *options)
+
+type options struct {
+	logger fswatcher.Logger
+}
+
+// Log the runs of the commands and their output, by default nothing is logged
+func WithLogger(logger fswatcher.Logger) Option {
+	return func(opts *options) {
+		if logger == nil {
+			logger = fswatcher.NopLogger
+		}
+		opts.logger = logger
+	}
+}
+
+// The values available to the templates of a rule: the fields of the event
+// ({{.Op}}, {{.Path}}, {{.OldPath}}, {{.Time}}), the path relative to the watched
+// folder ({{.Rel}}) and the watched folder ({{.Root}})
+type Data struct {
+	fswatcher.Event
+	Rel  string
+	Root string
+}
+
+// Runs the commands of the rules matching the events, it is the fswatcher.Handler of the watch:
+//
+//	engine, err := hook.New(root, config)
+//	dw, err := fswatcher.Handle(root, engine)
+//
+// The commands also receive the event in the environment variables FSWATCHER_OP,
+// FSWATCHER_PATH and FSWATCHER_OLD_PATH.
+type Engine struct {
+	root    string
+	logger  fswatcher.Logger
+	rules   []*rule
+	mutex   sync.Mutex
+	idle    *sync.Cond
+	running int
+	dropped uint64
+}
+
+type rule struct {
+	Rule
+	engine  *Engine
+	accept  func(event fswatcher.Event) bool
+	handler fswatcher.Handler
+	command []*template.Template
+	shell   *template.Template
+	env     map[string]*template.Template
+	dir     *template.Template
+
+	mutex sync.Mutex
+	// the events waiting for a worker, at most Queue
+	pending []fswatcher.Event
+	// the goroutines running the commands, at most Concurrency
+	workers int
+	// events dropped since the queue was last full
+	overflow int
+}
+
+const defaultQueue = 1000
+
+// An engine for the events of the watch of root
+func New(root string, config Config, opts ...Option) (*Engine, error) {
+	o := options{logger: fswatcher.NopLogger}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	engine := &Engine{root: filepath.Clean(root), logger: o.logger}
+	engine.idle = sync.NewCond(&engine.mutex)
+	for i, r := range config.Hooks {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("hook %d", i+1)
+		}
+		compiled, err := engine.compile(r)
+		if err != nil {
+			return nil, errors.Wrap(err, r.Name)
+		}
+		engine.rules = append(engine.rules, compiled)
+	}
+	return engine, nil
+}
+
+// Run the commands of the rules matching event, in the background
+func (engine *Engine) Handle(event fswatcher.Event) error {
+	handled := false
+	for _, r := range engine.rules {
+		if r.accept(event) {
+			handled = true
+			r.handler.Handle(event)
+		}
+	}
+	if !handled {
+		return fswatcher.ErrUnhandled
+	}
+	return nil
+}
+
+// Number of events dropped because the queue of their rule was full
+func (engine *Engine) Dropped() uint64 {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	return engine.dropped
+}
+
+// Wait for the running commands to complete. The commands of the events still debounced
+// are not waited for.
+func (engine *Engine) Wait() {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	for engine.running > 0 {
+		engine.idle.Wait()
+	}
+}
+
+// A WaitGroup would not allow the debounced events to start commands during a Wait
+func (engine *Engine) track(delta int) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	engine.running += delta
+	if engine.running == 0 {
+		engine.idle.Broadcast()
+	}
+}
+
+func (engine *Engine) compile(config Rule) (*rule, error) {
+	if (len(config.Command) == 0) == (config.Shell == "") {
+		return nil, errors.New("either command or shell is required")
+	}
+	if config.Concurrency < 0 {
+		return nil, errors.New("negative concurrency")
+	}
+	if config.Concurrency == 0 {
+		config.Concurrency = 1
+	}
+	if config.Queue < 0 {
+		return nil, errors.New("negative queue")
+	}
+	if config.Queue == 0 {
+		config.Queue = defaultQueue
+	}
+	r := &rule{
+		Rule:   config,
+		engine: engine,
+		env:    make(map[string]*template.Template),
+	}
+
+	var err error
+	parse := func(text string) *template.Template {
+		if err != nil {
+			return nil
+		}
+		var t *template.Template
+		t, err = template.New(config.Name).Option("missingkey=error").Parse(text)
+		return t
+	}
+	for _, arg := range config.Command {
+		r.command = append(r.command, parse(arg))
+	}
+	if config.Shell != "" {
+		r.shell = parse(config.Shell)
+	}
+	for key, value := range config.Env {
+		r.env[key] = parse(value)
+	}
+	if config.Dir != "" {
+		r.dir = parse(config.Dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	match, err := r.matcher()
+	if err != nil {
+		return nil, err
+	}
+	var ops fswatcher.Op
+	if len(config.Ops) > 0 {
+		if ops, err = fswatcher.ParseOp(strings.Join(config.Ops, "|")); err != nil {
+			return nil, err
+		}
+	}
+	r.accept = func(event fswatcher.Event) bool {
+		return (ops == 0 || event.Op&ops != 0) && match(event.Path)
+	}
+	r.handler = fswatcher.HandlerFunc(r.start)
+	if config.Debounce > 0 {
+		r.handler = fswatcher.Chain(r.handler, fswatcher.Debounce(config.Debounce))
+	}
+	return r, nil
+}
+
+// The path matcher of the rule
+func (r *rule) matcher() (func(path string) bool, error) {
+	if len(r.Paths) == 0 {
+		return func(string) bool { return true }, nil
+	}
+	mux := fswatcher.NewMux(r.engine.root)
+	matched := fswatcher.HandlerFunc(func(fswatcher.Event) error { return nil })
+	for _, pattern := range r.Paths {
+		if err := mux.Add(pattern, matched); err != nil {
+			return nil, err
+		}
+	}
+	return func(path string) bool {
+		return mux.Match(path) != nil
+	}, nil
+}
+
+// Queue the command for event, run in the background by up to Concurrency workers.
+// Registered as running right away, for Wait to include the commands queued.
+func (r *rule) start(event fswatcher.Event) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.pending) >= r.Queue {
+		if r.overflow == 0 {
+			r.engine.logger.Warnf("Hook %s: queue full, dropping the events", r.Name)
+		}
+		r.overflow++
+		r.engine.drop()
+		return nil
+	}
+	r.engine.track(1)
+	r.pending = append(r.pending, event)
+	if r.workers < r.Concurrency {
+		r.workers++
+		go r.work()
+	}
+	return nil
+}
+
+// Run the queued commands until the queue is empty
+func (r *rule) work() {
+	for {
+		r.mutex.Lock()
+		if len(r.pending) == 0 {
+			r.workers--
+			if r.overflow > 0 {
+				r.engine.logger.Warnf("Hook %s: %d events dropped", r.Name, r.overflow)
+				r.overflow = 0
+			}
+			r.mutex.Unlock()
+			return
+		}
+		event := r.pending[0]
+		r.pending[0] = fswatcher.Event{}
+		r.pending = r.pending[1:]
+		r.mutex.Unlock()
+
+		if err := r.run(event); err != nil {
+			r.engine.logger.Warnf("Hook %s on %s failed: %s", r.Name, event, err)
+		}
+		r.engine.track(-1)
+	}
+}
+
+func (engine *Engine) drop() {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	engine.dropped++
+}
+
+func (r *rule) run(event fswatcher.Event) error {
+	data := Data{Event: event, Rel: r.engine.rel(event.Path), Root: r.engine.root}
+
+	var err error
+	execute := func(t *template.Template) string {
+		if err != nil || t == nil {
+			return ""
+		}
+		buf := &bytes.Buffer{}
+		err = t.Execute(buf, data)
+		return buf.String()
+	}
+	var args []string
+	if r.shell != nil {
+		args = shell(execute(r.shell))
+	} else {
+		for _, t := range r.command {
+			args = append(args, execute(t))
+		}
+	}
+	env := append(os.Environ(),
+		"FSWATCHER_OP="+event.Op.String(),
+		"FSWATCHER_PATH="+event.Path,
+		"FSWATCHER_OLD_PATH="+event.OldPath)
+	for key, t := range r.env {
+		env = append(env, key+"="+execute(t))
+	}
+	dir := r.engine.root
+	if r.dir != nil {
+		dir = execute(r.dir)
+	}
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = env
+	cmd.Dir = dir
+	output := &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = output, output
+	setProcessGroup(cmd)
+	setWaitDelay(cmd, waitDelay)
+
+	r.engine.logger.Infof("Hook %s on %s: %s", r.Name, event, strings.Join(args, " "))
+	err = runTimeout(cmd, r.Timeout)
+	if out := strings.TrimRight(output.String(), "\n"); out != "" {
+		if err != nil {
+			r.engine.logger.Warnf("Hook %s output:\n%s", r.Name, out)
+		} else {
+			r.engine.logger.Infof("Hook %s output:\n%s", r.Name, out)
+		}
+	}
+	return err
+}
+
+// How long to wait for the output once a command exited, see setWaitDelay
+const waitDelay = time.Second
+
+// Run cmd, and kill its process group if it did not exit after timeout (unless 0)
+func runTimeout(cmd *exec.Cmd, timeout time.Duration) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if timeout <= 0 {
+		return cmd.Wait()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		killGroup(cmd)
+		<-done
+		return errors.Errorf("timeout after %s", timeout)
+	}
+}
+
+func (engine *Engine) rel(path string) string {
+	rel, err := filepath.Rel(engine.root, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+func shell(commandLine string) []string {
+	if runtime.GOOS == "windows" {
+		return []string{"cmd", "/C", commandLine}
+	}
+	return []string{"sh", "-c", commandLine}
+}
@@ -0,0 +1,189 @@
+package hook
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raomuyang/fswatcher"
+	"github.com/raomuyang/fswatcher/fswatchertest"
+)
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestLoadConfig(t *testing.T) {
+	tree := fswatchertest.NewTree(t)
+	tree.WriteFile("hooks.yml", `
+hooks:
+  - name: thumbnails
+    paths: ["assets/**/*.{png,jpg}"]
+    ops: [create, write]
+    debounce: 500ms
+    command: [convert, "{{.Path}}", "{{.Path}}.thumb.png"]
+    concurrency: 2
+    queue: 100
+    timeout: 1m
+`)
+	config, err := LoadConfig(tree.Path("hooks.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := config.Hooks[0]
+	if rule.Name != "thumbnails" || rule.Debounce != 500*time.Millisecond || rule.Timeout != time.Minute ||
+		rule.Concurrency != 2 || rule.Queue != 100 || len(rule.Command) != 3 || len(rule.Ops) != 2 {
+		t.Errorf("unexpected rule %+v", rule)
+	}
+
+	tree.WriteFile("invalid.yml", "hooks:\n  - nme: typo\n")
+	if _, err := LoadConfig(tree.Path("invalid.yml")); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+
+	invalid := []Rule{
+		{Name: "nothing to run"},
+		{Name: "both", Command: []string{"true"}, Shell: "true"},
+		{Name: "template", Shell: "echo {{.Path"},
+		{Name: "pattern", Shell: "true", Paths: []string{"{a"}},
+		{Name: "op", Shell: "true", Ops: []string{"create", "touch"}},
+		{Name: "queue", Shell: "true", Queue: -1},
+	}
+	for _, rule := range invalid {
+		if _, err := New(tree.Root, Config{Hooks: []Rule{rule}}); err == nil {
+			t.Errorf("%s: expected an error", rule.Name)
+		}
+	}
+}
+
+func TestEngine(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	tree := fswatchertest.NewTree(t, "docs/")
+	out := filepath.Join(t.TempDir(), "out")
+
+	engine, err := New(tree.Root, Config{Hooks: []Rule{
+		{
+			Name:    "docs",
+			Paths:   []string{"docs/**/*.md"},
+			Ops:     []string{"create", "write"},
+			Command: []string{"sh", "-c", `echo "docs $1 $2 $CHANGED" >> ` + out, "sh", "{{.Op}}", "{{.Rel}}"},
+			Env:     map[string]string{"CHANGED": "{{.Root}}"},
+		},
+		{
+			Name:  "moves",
+			Shell: `echo "moved $FSWATCHER_OLD_PATH" >> ` + out,
+			Ops:   []string{"create"},
+		},
+		{
+			Name:    "slow",
+			Paths:   []string{"slow"},
+			Shell:   "sleep 3; true",
+			Timeout: 200 * time.Millisecond,
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine.Handle(fswatcher.Event{Op: fswatcher.Write, Path: tree.Path("docs/a/b.md")})
+	engine.Handle(fswatcher.Event{Op: fswatcher.Remove, Path: tree.Path("docs/c.md")})
+	engine.Wait()
+	engine.Handle(fswatcher.Event{Op: fswatcher.Create, Path: tree.Path("docs/d.md"), OldPath: tree.Path("x")})
+	engine.Wait()
+
+	lines := readLines(t, out)
+	expected := []string{
+		"docs WRITE docs/a/b.md " + tree.Root,
+		"docs CREATE docs/d.md " + tree.Root,
+		"moved " + tree.Path("x"),
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %q, got %q", expected, lines)
+	}
+	for _, line := range expected {
+		if !strings.Contains(strings.Join(lines, "\n"), line) {
+			t.Errorf("expected %q in %q", line, lines)
+		}
+	}
+
+	start := time.Now()
+	if err := engine.Handle(fswatcher.Event{Op: fswatcher.Write, Path: tree.Path("slow")}); err != nil {
+		t.Fatal(err)
+	}
+	engine.Wait()
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the command to be killed after its timeout, took %s", elapsed)
+	}
+
+	if err := engine.Handle(fswatcher.Event{Op: fswatcher.Remove, Path: tree.Path("other")}); err != fswatcher.ErrUnhandled {
+		t.Errorf("expected an unhandled event, got %v", err)
+	}
+}
+
+func TestEngine_DebounceAndConcurrency(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	tree := fswatchertest.NewTree(t)
+	out := filepath.Join(t.TempDir(), "out")
+
+	engine, err := New(tree.Root, Config{Hooks: []Rule{{
+		Name:     "build",
+		Debounce: 50 * time.Millisecond,
+		// fails if another run is in progress
+		Shell: `mkdir ` + out + `.lock && echo "$FSWATCHER_PATH" >> ` + out + ` && sleep 0.1 && rmdir ` + out + `.lock`,
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		engine.Handle(fswatcher.Event{Op: fswatcher.Write, Path: tree.Path("a")})
+		engine.Handle(fswatcher.Event{Op: fswatcher.Write, Path: tree.Path("b")})
+	}
+	time.Sleep(200 * time.Millisecond)
+	engine.Wait()
+
+	lines := readLines(t, out)
+	if len(lines) != 2 {
+		t.Errorf("expected one run per path, got %q", lines)
+	}
+}
+
+func TestEngine_Queue(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	tree := fswatchertest.NewTree(t)
+	out := filepath.Join(t.TempDir(), "out")
+
+	engine, err := New(tree.Root, Config{Hooks: []Rule{{
+		Name:  "slow",
+		Shell: `echo "$FSWATCHER_PATH" >> ` + out + ` && sleep 0.2`,
+		Queue: 1,
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		engine.Handle(fswatcher.Event{Op: fswatcher.Write, Path: tree.Path(fmt.Sprint(i))})
+	}
+	engine.Wait()
+
+	lines := readLines(t, out)
+	if dropped := engine.Dropped(); len(lines)+int(dropped) != 10 || dropped < 8 {
+		t.Errorf("expected at most 2 runs and the other events dropped, got %q and %d dropped", lines, dropped)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package hook
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Start the command in a new process group, to kill its children as well
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func killGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,23 @@
+//go:build windows
+// +build windows
+
+package hook
+
+import (
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// Kill the process and its descendants, there is no process group to signal
+func killGroup(cmd *exec.Cmd) error {
+	kill := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid))
+	if err := kill.Run(); err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
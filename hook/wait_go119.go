@@ -0,0 +1,12 @@
+//go:build !go1.20
+// +build !go1.20
+
+package hook
+
+import (
+	"os/exec"
+	"time"
+)
+
+// exec.Cmd.WaitDelay requires Go 1.20
+func setWaitDelay(cmd *exec.Cmd, delay time.Duration) {}
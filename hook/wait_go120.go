@@ -0,0 +1,15 @@
+//go:build go1.20
+// +build go1.20
+
+package hook
+
+import (
+	"os/exec"
+	"time"
+)
+
+// Stop waiting for the output after delay once the command exited, when processes it left
+// in the background still hold its stdout
+func setWaitDelay(cmd *exec.Cmd, delay time.Duration) {
+	cmd.WaitDelay = delay
+}
@@ -0,0 +1,160 @@
+//go:build linux
+// +build linux
+
+package fswatcher
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"unsafe"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const inotifyMask = unix.IN_CREATE | unix.IN_MODIFY | unix.IN_DELETE | unix.IN_DELETE_SELF |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_MOVE_SELF | unix.IN_ATTRIB | unix.IN_CLOSE_WRITE
+
+// The native Linux backend, reading inotify directly
+type inotifyBackend struct {
+	// not file.Fd(), which would switch the descriptor back to blocking mode
+	fd     int
+	file   *os.File
+	events chan backendEvent
+	errors chan error
+	done   chan struct{}
+	once   sync.Once
+
+	mutex sync.Mutex
+	paths map[int32]string
+}
+
+func newInotifyBackend() (backend, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, errors.Wrap(err, "inotify_init1")
+	}
+	b := &inotifyBackend{
+		fd: fd,
+		// a non blocking file is read through the runtime poller, Close interrupts the read
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		events: make(chan backendEvent),
+		errors: make(chan error),
+		done:   make(chan struct{}),
+		paths:  make(map[int32]string),
+	}
+	go b.read()
+	return b, nil
+}
+
+func (b *inotifyBackend) Add(path string) error {
+	path = filepath.Clean(path)
+	wd, err := unix.InotifyAddWatch(b.fd, path, inotifyMask)
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: path, Err: err}
+	}
+	b.mutex.Lock()
+	b.paths[int32(wd)] = path
+	b.mutex.Unlock()
+	return nil
+}
+
+func (b *inotifyBackend) Events() <-chan backendEvent {
+	return b.events
+}
+
+func (b *inotifyBackend) Errors() <-chan error {
+	return b.errors
+}
+
+func (b *inotifyBackend) Close() error {
+	var err error
+	b.once.Do(func() {
+		close(b.done)
+		err = b.file.Close()
+	})
+	return err
+}
+
+func (b *inotifyBackend) read() {
+	defer close(b.events)
+	buf := make([]byte, unix.SizeofInotifyEvent*4096)
+	for {
+		n, err := b.file.Read(buf)
+		if err != nil {
+			select {
+			case <-b.done:
+			case b.errors <- errors.Wrap(err, "read inotify events"):
+			}
+			return
+		}
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			name := ""
+			if raw.Len > 0 {
+				name = string(bytes.TrimRight(buf[nameStart:nameStart+int(raw.Len)], "\x00"))
+			}
+			offset = nameStart + int(raw.Len)
+
+			event, ok := b.convert(raw, name)
+			if !ok {
+				continue
+			}
+			select {
+			case b.events <- event:
+			case <-b.done:
+				return
+			}
+		}
+	}
+}
+
+func (b *inotifyBackend) convert(raw *unix.InotifyEvent, name string) (event backendEvent, ok bool) {
+	mask := raw.Mask
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		event.extra = Overflow
+		return event, true
+	}
+
+	b.mutex.Lock()
+	path, known := b.paths[raw.Wd]
+	if mask&unix.IN_IGNORED != 0 {
+		delete(b.paths, raw.Wd)
+	}
+	b.mutex.Unlock()
+	if !known || mask&unix.IN_IGNORED != 0 {
+		return event, false
+	}
+
+	event.Name = path
+	if name != "" {
+		event.Name = filepath.Join(path, name)
+	}
+	event.cookie = raw.Cookie
+
+	if mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+		event.Op |= fsnotify.Create
+	}
+	if mask&unix.IN_MODIFY != 0 {
+		event.Op |= fsnotify.Write
+	}
+	if mask&(unix.IN_DELETE|unix.IN_DELETE_SELF) != 0 {
+		event.Op |= fsnotify.Remove
+	}
+	if mask&(unix.IN_MOVED_FROM|unix.IN_MOVE_SELF) != 0 {
+		event.Op |= fsnotify.Rename
+	}
+	if mask&unix.IN_ATTRIB != 0 {
+		// reported as Attrib only, so that the metrics count it once
+		event.extra |= Attrib
+	}
+	if mask&unix.IN_CLOSE_WRITE != 0 {
+		event.extra |= CloseWrite
+	}
+	return event, event.Op != 0 || event.extra != 0
+}
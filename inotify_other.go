@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package fswatcher
+
+import (
+	"github.com/pkg/errors"
+)
+
+func newInotifyBackend() (backend, error) {
+	return nil, errors.New("the native backend is only available on linux")
+}
@@ -17,7 +17,8 @@ import (
 
 	"github.com/raomuyang/fswatcher"
 	"github.com/raomuyang/fswatcher/filesync"
-	"io/ioutil"
+	fswlogrus "github.com/raomuyang/fswatcher/logrus"
+	"net/http"
 	"os/signal"
 	"sync"
 	"syscall"
@@ -35,6 +36,22 @@ type Config struct {
 
 	// Delay to process during a write/crate event
 	OptDelay	  int 		 	  `yaml:"opt_delay"`
+
+	// Address to serve metrics on (e.g. ":9100"), disabled when empty
+	MetricsAddr   string          `yaml:"metrics_addr"`
+
+	// File to record the watcher events in (JSON lines), disabled when empty
+	RecordPath    string          `yaml:"record_path"`
+
+	// What to do when a folder cannot be watched: best-effort (default), fail-fast or retry
+	WatchPolicy   string          `yaml:"watch_policy"`
+}
+
+var watchPolicies = map[string]fswatcher.WatchPolicy{
+	"":            fswatcher.BestEffort,
+	"best-effort": fswatcher.BestEffort,
+	"fail-fast":   fswatcher.FailFast,
+	"retry":       fswatcher.RetryFailed,
 }
 
 const (
@@ -58,6 +75,13 @@ var (
 	// 延迟触发写操作回调
 	delayWriteTriggers = make(map[string]*fswatcher.DelayTrigger)
 
+	// 监控指标，与watcher的指标共用
+	registry      = fswatcher.NewRegistry()
+	uploads       = registry.Counter("iusync_uploads_total", "Files uploaded.", nil)
+	uploadErrors  = registry.Counter("iusync_upload_errors_total", "Failed uploads.", nil)
+	uploadedBytes = registry.Counter("iusync_uploaded_bytes_total", "Bytes uploaded.", nil)
+	deletes       = registry.Counter("iusync_deletes_total", "Remote objects deleted.", nil)
+	deleteErrors  = registry.Counter("iusync_delete_errors_total", "Failed deletions.", nil)
 )
 
 func init() {
@@ -70,6 +94,10 @@ func init() {
 		LogDir = filepath.Join(u.HomeDir, FOLDER)
 	}
 
+	registry.GaugeFunc("iusync_queue_depth", "Files waiting to be processed.",
+		fswatcher.Labels{"queue": "upload"}, func() float64 { return float64(len(postQueue)) })
+	registry.GaugeFunc("iusync_queue_depth", "Files waiting to be processed.",
+		fswatcher.Labels{"queue": "delete"}, func() float64 { return float64(len(deleteQueue)) })
 }
 
 func main() {
@@ -90,12 +118,12 @@ func main() {
 
 	root := path.Clean(*target)
 
-	scanFolder(root)
-
 	dw := startWatcher(root)
 
 	go process(fsSync, root)
 
+	serveMetrics()
+
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT)
 
@@ -124,7 +152,7 @@ func process(fsSync filesync.FileSync, root string) {
 }
 
 // start watch a folder
-func startWatcher(root string) fswatcher.DeepWatch {
+func startWatcher(root string) *fswatcher.DeepWatch {
 
 	// RENAME之后，这个文件相当于被删除，执行REMOVE相同的操作，删除云端文件
 	callable := fswatcher.Callable{
@@ -132,16 +160,62 @@ func startWatcher(root string) fswatcher.DeepWatch {
 		OnRemove: onDeleteAction,
 		OnCreate: onCreateOrWriteAction,
 		OnWrite:  onCreateOrWriteAction,
+		// 初始化扫描到的文件直接加入待上传的队列
+		OnExisting: onExistingAction,
+	}
+	policy, ok := watchPolicies[config.WatchPolicy]
+	if !ok {
+		log.Errorf("Unsupported watch policy: %s", config.WatchPolicy)
+		os.Exit(1)
+	}
+	opts := []fswatcher.Option{
+		fswatcher.WithRegistry(registry),
+		fswatcher.WithLogger(fswlogrus.New(log.StandardLogger())),
+		fswatcher.WithWaitForCreation(),
+		fswatcher.WithWatchPolicy(policy),
+	}
+	if config.ScanAtStart {
+		opts = append(opts, fswatcher.WithInitialScan())
+	} else {
+		log.Info("Scan at start: false")
+	}
+	if !config.IncludeHidden {
+		opts = append(opts, fswatcher.WithIgnoreHidden())
+	}
+	if len(config.RecordPath) > 0 {
+		recorder, err := fswatcher.CreateRecorder(config.RecordPath)
+		if err != nil {
+			log.Errorf("Create recorder failed: %s", err)
+			os.Exit(1)
+		}
+		opts = append(opts, fswatcher.WithRecorder(recorder))
 	}
-	dw, err := fswatcher.Watch(root, callable)
+	dw, err := fswatcher.Watch(root, callable, opts...)
 	if err != nil {
 		log.Errorf("Create watcher failed: %s", err)
 		os.Exit(1)
 	}
+	// the changes in these folders are not synchronized
+	if errs := dw.Errors(); errs != nil {
+		log.Warnf("Watcher incomplete: %s", errs)
+	}
 	return dw
 
 }
 
+// expose the metrics of watcher and sync over http
+func serveMetrics() {
+	if len(config.MetricsAddr) == 0 {
+		return
+	}
+	go func() {
+		err := http.ListenAndServe(config.MetricsAddr, registry)
+		if err != nil {
+			log.Errorf("Serve metrics failed: %s", err)
+		}
+	}()
+}
+
 func printStatus() {
 	fmt.Printf("=== Start file wathcer ===\n"+
 		" storage type: %s\n"+
@@ -153,10 +227,11 @@ func printStatus() {
 
 // init FileSync by store type
 func createSyncTool() (fsSync filesync.FileSync, err error) {
+	logger := filesync.WithLogger(fswlogrus.New(log.StandardLogger()))
 	if config.StoreType == "oss" {
-		fsSync = filesync.NewOSSFileSync(config.Access)
+		fsSync = filesync.NewOSSFileSync(config.Access, logger)
 	} else if config.StoreType == "qiniu" {
-		fsSync = filesync.NewQiniuFileSync(config.Access)
+		fsSync = filesync.NewQiniuFileSync(config.Access, logger)
 	} else {
 		err = errors.New("unsupported store type: " + config.StoreType)
 		return
@@ -167,7 +242,7 @@ func createSyncTool() (fsSync filesync.FileSync, err error) {
 // parse args
 func parseArgs() (target *string, config Config) {
 	target = flag.String("target", "",
-		"Target path to listen (auto created when it does not exist)")
+		"Target path to listen (watched as soon as it is created when it does not exist)")
 	confPath := flag.String("conf", "conf.yml", "config file path")
 	help := flag.Bool("help", false, "Print usage")
 	flag.Parse()
@@ -266,6 +341,10 @@ func onCreateOrWriteAction(filePath string) {
 
 }
 
+func onExistingAction(filePath string) {
+	postQueue <- filePath
+}
+
 func onDeleteAction(filePath string) {
 	log.Debugf("Deleted file enqueue: %s", filePath)
 	deleteQueue <- filePath
@@ -284,8 +363,11 @@ func upload(fsSync filesync.FileSync, filePath string, root string) {
 		key := getKey(filePath, root)
 		url, err := fsSync.Put(filePath, key)
 		if err != nil {
+			uploadErrors.Inc()
 			log.Errorf("Error: file sync failed: %s, cause: %s", filePath, err.Error())
 		} else {
+			uploads.Inc()
+			uploadedBytes.Add(uint64(file.Size()))
 			fmt.Println("New:", url)
 		}
 	}
@@ -295,6 +377,11 @@ func upload(fsSync filesync.FileSync, filePath string, root string) {
 func deleteKey(fsSync filesync.FileSync, filePath string, root string) {
 	key := getKey(filePath, root)
 	err := fsSync.Delete(key)
+	if err != nil {
+		deleteErrors.Inc()
+	} else {
+		deletes.Inc()
+	}
 	log.Infof("Delete key: %s, err: %v", key, err)
 }
 
@@ -324,32 +411,3 @@ func prepareLogger() {
 	}
 	log.SetOutput(file)
 }
-
-// 初始化扫描文件夹，将所有文件添加到待上传的队列中
-func scanFolder(root string) {
-	if !config.ScanAtStart {
-		log.Info("Scan at start: false")
-		return
-	}
-
-	files, err := ioutil.ReadDir(root)
-	if err != nil {
-		log.Warnf("read directory error: %s", err.Error())
-		return
-	}
-
-	for i := range files {
-		file := files[i]
-		sub := filepath.Join(root, file.Name())
-		if file.Name()[0] == '.' && !config.IncludeHidden {
-			log.Infof("Ignore hidden file/path: %s", sub)
-			continue
-		}
-
-		if file.IsDir() {
-			scanFolder(sub)
-		} else {
-			postQueue <- sub
-		}
-	}
-}
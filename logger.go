@@ -0,0 +1,23 @@
+package fswatcher
+
+// Logger receives the log output of watchers. Watchers log nothing unless a Logger
+// is given with WithLogger.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// A Logger discarding everything
+var NopLogger Logger = nopLogger{}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(format string, args ...interface{}) {}
+
+func (nopLogger) Infof(format string, args ...interface{}) {}
+
+func (nopLogger) Warnf(format string, args ...interface{}) {}
+
+func (nopLogger) Errorf(format string, args ...interface{}) {}
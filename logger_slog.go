@@ -0,0 +1,45 @@
+//go:build go1.21
+// +build go1.21
+
+package fswatcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// Adapt a log/slog logger, nil means slog.Default()
+func NewSlogLogger(logger *slog.Logger) Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return slogLogger{logger: logger}
+}
+
+func (l slogLogger) logf(level slog.Level, format string, args []interface{}) {
+	ctx := context.Background()
+	if l.logger.Enabled(ctx, level) {
+		l.logger.Log(ctx, level, fmt.Sprintf(format, args...))
+	}
+}
+
+func (l slogLogger) Debugf(format string, args ...interface{}) {
+	l.logf(slog.LevelDebug, format, args)
+}
+
+func (l slogLogger) Infof(format string, args ...interface{}) {
+	l.logf(slog.LevelInfo, format, args)
+}
+
+func (l slogLogger) Warnf(format string, args ...interface{}) {
+	l.logf(slog.LevelWarn, format, args)
+}
+
+func (l slogLogger) Errorf(format string, args ...interface{}) {
+	l.logf(slog.LevelError, format, args)
+}
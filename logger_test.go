@@ -0,0 +1,47 @@
+package fswatcher
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type memoryLogger struct {
+	mutex sync.Mutex
+	lines []string
+}
+
+func (l *memoryLogger) logf(level, format string, args []interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.lines = append(l.lines, level+" "+fmt.Sprintf(format, args...))
+}
+
+func (l *memoryLogger) Debugf(format string, args ...interface{}) { l.logf("DEBUG", format, args) }
+
+func (l *memoryLogger) Infof(format string, args ...interface{}) { l.logf("INFO", format, args) }
+
+func (l *memoryLogger) Warnf(format string, args ...interface{}) { l.logf("WARN", format, args) }
+
+func (l *memoryLogger) Errorf(format string, args ...interface{}) { l.logf("ERROR", format, args) }
+
+func TestWithLogger(t *testing.T) {
+	root := ".test-logger"
+	os.MkdirAll(root, os.ModePerm)
+	defer os.RemoveAll(root)
+
+	logger := &memoryLogger{}
+	dw, err := Watch(root, Callable{}, WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dw.Stop()
+
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+	if len(logger.lines) == 0 || !strings.HasPrefix(logger.lines[0], "INFO Start watcher: "+root) {
+		t.Errorf("unexpected log output: %v", logger.lines)
+	}
+}
@@ -0,0 +1,18 @@
+// Package logrus adapts a logrus logger to fswatcher.Logger, so that the fswatcher package
+// itself does not depend on logrus:
+//
+//	dw, err := fswatcher.Watch(path, callable, fswatcher.WithLogger(logrus.New(log.StandardLogger())))
+package logrus
+
+import (
+	"github.com/raomuyang/fswatcher"
+	"github.com/sirupsen/logrus"
+)
+
+// Adapt a logrus logger (or entry), nil means the logrus standard logger
+func New(logger logrus.FieldLogger) fswatcher.Logger {
+	if logger == nil {
+		return logrus.StandardLogger()
+	}
+	return logger
+}
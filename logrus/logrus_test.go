@@ -0,0 +1,22 @@
+package logrus
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestNew(t *testing.T) {
+	if New(nil) != logrus.StandardLogger() {
+		t.Error("expected the standard logger by default")
+	}
+	out := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.SetOutput(out)
+	New(logger.WithField("root", "/etc")).Warnf("watch %s failed", "/etc/a")
+	if line := out.String(); !strings.Contains(line, `msg="watch /etc/a failed"`) || !strings.Contains(line, "root=/etc") {
+		t.Errorf("unexpected output %q", line)
+	}
+}
@@ -0,0 +1,313 @@
+package fswatcher
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Labels of a metric series
+type Labels map[string]string
+
+// Default histogram buckets (seconds) used for callback latency
+var DefaultBuckets = []float64{.0005, .001, .005, .01, .05, .1, .5, 1, 5}
+
+// Registry holds metrics and exposes them in the Prometheus text exposition format.
+// A Registry is an http.Handler, it can be mounted directly on a mux (e.g. at /metrics).
+type Registry struct {
+	mutex    sync.Mutex
+	families []*family
+	byName   map[string]*family
+}
+
+type family struct {
+	name   string
+	help   string
+	kind   string
+	series []*series
+}
+
+type series struct {
+	labels string
+	metric writable
+}
+
+type writable interface {
+	write(w io.Writer, name, labels string) error
+}
+
+func NewRegistry() *Registry {
+	return &Registry{byName: make(map[string]*family)}
+}
+
+// Get or create a counter
+func (reg *Registry) Counter(name, help string, labels Labels) *Counter {
+	return reg.register(name, help, "counter", labels, func() writable {
+		return &Counter{}
+	}).(*Counter)
+}
+
+// Get or create a gauge
+func (reg *Registry) Gauge(name, help string, labels Labels) *Gauge {
+	return reg.register(name, help, "gauge", labels, func() writable {
+		return &Gauge{}
+	}).(*Gauge)
+}
+
+// Register a gauge whose value is computed by fn at collection time
+func (reg *Registry) GaugeFunc(name, help string, labels Labels, fn func() float64) {
+	reg.register(name, help, "gauge", labels, func() writable {
+		return gaugeFunc(fn)
+	})
+}
+
+// Get or create a histogram, buckets are the upper bounds in increasing order
+func (reg *Registry) Histogram(name, help string, labels Labels, buckets []float64) *Histogram {
+	return reg.register(name, help, "histogram", labels, func() writable {
+		return newHistogram(buckets)
+	}).(*Histogram)
+}
+
+func (reg *Registry) register(name, help, kind string, labels Labels, create func() writable) writable {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+
+	f := reg.byName[name]
+	if f == nil {
+		f = &family{name: name, help: help, kind: kind}
+		reg.byName[name] = f
+		reg.families = append(reg.families, f)
+	} else if f.kind != kind {
+		panic(fmt.Sprintf("metric %s already registered as %s", name, f.kind))
+	}
+
+	formatted := formatLabels(labels)
+	for _, s := range f.series {
+		if s.labels == formatted {
+			return s.metric
+		}
+	}
+	m := create()
+	f.series = append(f.series, &series{labels: formatted, metric: m})
+	return m
+}
+
+// Write all metrics in the Prometheus text exposition format
+func (reg *Registry) Write(w io.Writer) error {
+	reg.mutex.Lock()
+	families := make([]*family, len(reg.families))
+	copy(families, reg.families)
+	reg.mutex.Unlock()
+
+	for _, f := range families {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n",
+			f.name, escapeHelp(f.help), f.name, f.kind); err != nil {
+			return err
+		}
+		reg.mutex.Lock()
+		all := make([]*series, len(f.series))
+		copy(all, f.series)
+		reg.mutex.Unlock()
+		for _, s := range all {
+			if err := s.metric.write(w, f.name, s.labels); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (reg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	reg.Write(w)
+}
+
+// A monotonically increasing counter
+type Counter struct {
+	value uint64
+}
+
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.value, 1)
+}
+
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.value, n)
+}
+
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.value)
+}
+
+func (c *Counter) write(w io.Writer, name, labels string) error {
+	_, err := fmt.Fprintf(w, "%s%s %d\n", name, wrapLabels(labels), c.Value())
+	return err
+}
+
+// A value that can go up and down
+type Gauge struct {
+	value int64
+}
+
+func (g *Gauge) Set(v int64) {
+	atomic.StoreInt64(&g.value, v)
+}
+
+func (g *Gauge) Add(n int64) {
+	atomic.AddInt64(&g.value, n)
+}
+
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+func (g *Gauge) Value() int64 {
+	return atomic.LoadInt64(&g.value)
+}
+
+func (g *Gauge) write(w io.Writer, name, labels string) error {
+	_, err := fmt.Fprintf(w, "%s%s %d\n", name, wrapLabels(labels), g.Value())
+	return err
+}
+
+type gaugeFunc func() float64
+
+func (fn gaugeFunc) write(w io.Writer, name, labels string) error {
+	_, err := fmt.Fprintf(w, "%s%s %s\n", name, wrapLabels(labels), formatFloat(fn()))
+	return err
+}
+
+// Samples observations into buckets
+type Histogram struct {
+	mutex   sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+// A point-in-time copy of a histogram, Counts are cumulative and correspond to Buckets
+type HistogramSnapshot struct {
+	Buckets []float64
+	Counts  []uint64
+	Count   uint64
+	Sum     float64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	b := make([]float64, len(buckets))
+	copy(b, buckets)
+	sort.Float64s(b)
+	return &Histogram{buckets: b, counts: make([]uint64, len(b))}
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	i := sort.SearchFloat64s(h.buckets, v)
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	snapshot := HistogramSnapshot{
+		Buckets: make([]float64, len(h.buckets)),
+		Counts:  make([]uint64, len(h.counts)),
+		Count:   h.count,
+		Sum:     h.sum,
+	}
+	copy(snapshot.Buckets, h.buckets)
+	var cumulative uint64
+	for i, c := range h.counts {
+		cumulative += c
+		snapshot.Counts[i] = cumulative
+	}
+	return snapshot
+}
+
+func (h *Histogram) write(w io.Writer, name, labels string) error {
+	snapshot := h.Snapshot()
+	for i, upper := range snapshot.Buckets {
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", name,
+			wrapLabels(joinLabels(labels, `le="`+formatFloat(upper)+`"`)), snapshot.Counts[i]); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+		name, wrapLabels(joinLabels(labels, `le="+Inf"`)), snapshot.Count,
+		name, wrapLabels(labels), formatFloat(snapshot.Sum),
+		name, wrapLabels(labels), snapshot.Count)
+	return err
+}
+
+func formatLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + `="` + escapeLabelValue(labels[k]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+func joinLabels(labels, extra string) string {
+	if len(labels) == 0 {
+		return extra
+	}
+	return labels + "," + extra
+}
+
+func wrapLabels(labels string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,120 @@
+package fswatcher
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	reg := NewRegistry()
+	reg.Counter("test_total", "A counter.", Labels{"op": "create"}).Add(3)
+	reg.Counter("test_total", "A counter.", Labels{"op": "write"}).Inc()
+	reg.Gauge("test_depth", "A gauge.", nil).Set(7)
+	reg.GaugeFunc("test_func", "A gauge func.", nil, func() float64 { return 1.5 })
+	h := reg.Histogram("test_seconds", "A histogram.", Labels{"root": `a"b`}, []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(2)
+
+	buf := &bytes.Buffer{}
+	if err := reg.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP test_total A counter.
+# TYPE test_total counter
+test_total{op="create"} 3
+test_total{op="write"} 1
+# HELP test_depth A gauge.
+# TYPE test_depth gauge
+test_depth 7
+# HELP test_func A gauge func.
+# TYPE test_func gauge
+test_func 1.5
+# HELP test_seconds A histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{root="a\"b",le="0.1"} 1
+test_seconds_bucket{root="a\"b",le="1"} 2
+test_seconds_bucket{root="a\"b",le="+Inf"} 3
+test_seconds_sum{root="a\"b"} 2.55
+test_seconds_count{root="a\"b"} 3
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+}
+
+func TestRegistry_SameSeries(t *testing.T) {
+	reg := NewRegistry()
+	a := reg.Counter("test_total", "", Labels{"a": "1", "b": "2"})
+	b := reg.Counter("test_total", "", Labels{"b": "2", "a": "1"})
+	if a != b {
+		t.Error("expected the same counter for equal labels")
+	}
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	reg := NewRegistry()
+	reg.Counter("test_total", "A counter.", nil).Inc()
+
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type: %s", rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), "test_total 1\n") {
+		t.Errorf("unexpected body: %s", rec.Body.String())
+	}
+}
+
+func TestDeepWatch_Stats(t *testing.T) {
+	root := ".test-stats"
+	os.MkdirAll(root+"/sub", os.ModePerm)
+	defer os.RemoveAll(root)
+
+	reg := NewRegistry()
+	dw, err := Watch(root, Callable{}, WithRegistry(reg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dw.Stop()
+
+	if dw.Registry() != reg {
+		t.Error("registry not used")
+	}
+	stats := dw.Stats()
+	if stats.WatchedDirs != 2 {
+		t.Errorf("expected 2 watched dirs, got %d", stats.WatchedDirs)
+	}
+	if _, ok := stats.Events["create"]; !ok {
+		t.Error("missing create counter")
+	}
+}
+
+func TestDeepWatch_StatsDropped(t *testing.T) {
+	root := ".test-stats-dropped"
+	os.MkdirAll(root, os.ModePerm)
+	defer os.RemoveAll(root)
+
+	created := make(chan string, 10)
+	dw, err := Watch(root, Callable{OnCreate: func(filePath string) {
+		created <- filePath
+	}}, WithIgnoreHidden())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dw.Stop()
+
+	// the events of a folder are reported in order: the hidden file is filtered out first
+	for _, name := range []string{".hidden", "visible"} {
+		f, _ := os.Create(filepath.Join(root, name))
+		f.Close()
+	}
+	waitPath(t, created, filepath.Join(root, "visible"))
+	if stats := dw.Stats(); stats.Dropped == 0 {
+		t.Errorf("expected the hidden file events to be counted as dropped, got %+v", stats)
+	}
+}
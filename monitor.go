@@ -0,0 +1,190 @@
+package fswatcher
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// A measure of a folder checked by a Monitor
+type ThresholdMetric int
+
+const (
+	// Total size of the files below the folder, in bytes
+	ThresholdBytes ThresholdMetric = iota
+	// Number of files below the folder
+	ThresholdFiles
+)
+
+func (metric ThresholdMetric) String() string {
+	switch metric {
+	case ThresholdBytes:
+		return "bytes"
+	case ThresholdFiles:
+		return "files"
+	}
+	return "unknown"
+}
+
+// A limit of a folder of the watched root
+type Threshold struct {
+	// Path of the folder, the root itself or a folder below it
+	Dir    string
+	Metric ThresholdMetric
+	// The threshold is crossed when the value is above the limit
+	Limit int64
+}
+
+// Options of NewMonitor
+type MonitorOptions struct {
+	Thresholds []Threshold
+	// Called when the value of a folder goes above a limit, also at start
+	OnThreshold func(dir string, metric ThresholdMetric, value int64)
+	// Called when the value of a folder goes back to the limit or below
+	OnRecover func(dir string, metric ThresholdMetric, value int64)
+	// Options of the underlying DeepWatch, e.g. WithLogger
+	Options []Option
+}
+
+// Keeps the total size and number of files of the folders of a watched root up to date,
+// and reports the thresholds crossed, without scanning the folders again
+type Monitor struct {
+	opts     MonitorOptions
+	tree     *Tree
+	dw       *DeepWatch
+	mutex    sync.Mutex
+	exceeded []bool
+	// receives the result of the scan of the tree, see WithInitialScan
+	ready chan error
+}
+
+// Start monitoring the folders of root
+func NewMonitor(root string, opts MonitorOptions) (*Monitor, error) {
+	if _, err := os.Lstat(root); err != nil {
+		return nil, err
+	}
+	root = filepath.Clean(root)
+	options := append([]Option{WithInitialScan()}, opts.Options...)
+	include, err := watchedPaths(root, newOptions(options))
+	if err != nil {
+		return nil, err
+	}
+	monitor := &Monitor{
+		opts:     opts,
+		tree:     &Tree{root: root, include: include},
+		exceeded: make([]bool, len(opts.Thresholds)),
+		ready:    make(chan error, 1),
+	}
+	monitor.opts.Thresholds = make([]Threshold, len(opts.Thresholds))
+	for i, threshold := range opts.Thresholds {
+		threshold.Dir = filepath.Clean(threshold.Dir)
+		monitor.opts.Thresholds[i] = threshold
+	}
+
+	// the tree is scanned once the folders are watched, the events received meanwhile are
+	// held until then and apply on top of the scan
+	monitor.dw, err = Handle(root, HandlerFunc(monitor.handle), options...)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case err = <-monitor.ready:
+	case <-monitor.dw.Stopped():
+		err = errors.New("watch stopped")
+		if errs := monitor.dw.Errors(); errs != nil {
+			err = errs
+		}
+	}
+	if err != nil {
+		monitor.dw.Stop()
+		return nil, err
+	}
+	return monitor, nil
+}
+
+// Whether the DeepWatch of root with o reports path, see WithMaxDepth, WithIgnoreHidden and
+// WithSparseWatch: the tree of the Monitor counts the same paths
+func watchedPaths(root string, o options) (func(path string, dir bool) bool, error) {
+	var sparse *sparseSet
+	if len(o.sparse) > 0 {
+		var err error
+		if sparse, err = newSparseSet(o.sparse); err != nil {
+			return nil, err
+		}
+	}
+	return func(path string, dir bool) bool {
+		if path == root {
+			return true
+		}
+		// the entries of the deepest folders watched are reported
+		if !withinDepth(root, filepath.Dir(path), o.maxDepth) || (o.hidden && isHidden(root, path)) {
+			return false
+		}
+		if sparse == nil {
+			return true
+		}
+		rel := relSlash(root, path)
+		return sparse.match(rel) || (dir && sparse.wants(rel))
+	}, nil
+}
+
+// Stop monitoring
+func (monitor *Monitor) Stop() {
+	monitor.dw.Stop()
+}
+
+// Stopped returns a channel closed when the monitor has stopped
+func (monitor *Monitor) Stopped() <-chan struct{} {
+	return monitor.dw.Stopped()
+}
+
+// The model of the monitored root
+func (monitor *Monitor) Tree() *Tree {
+	return monitor.tree
+}
+
+func (monitor *Monitor) handle(event Event) error {
+	switch event.Op {
+	case Existing:
+		// scanned at once on Ready
+		return nil
+	case Ready:
+		err := monitor.tree.Rescan()
+		if err == nil {
+			monitor.check()
+		}
+		monitor.ready <- err
+		return err
+	}
+	err := monitor.tree.Handle(event)
+	monitor.check()
+	return err
+}
+
+// Compare every folder with its limits and report the changes
+func (monitor *Monitor) check() {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+	for i, threshold := range monitor.opts.Thresholds {
+		var value int64
+		if node, ok := monitor.tree.Lookup(threshold.Dir); ok {
+			value = node.Size
+			if threshold.Metric == ThresholdFiles {
+				value = int64(node.Files)
+			}
+		}
+
+		exceeded := value > threshold.Limit
+		if exceeded == monitor.exceeded[i] {
+			continue
+		}
+		monitor.exceeded[i] = exceeded
+		if exceeded && monitor.opts.OnThreshold != nil {
+			monitor.opts.OnThreshold(threshold.Dir, threshold.Metric, value)
+		} else if !exceeded && monitor.opts.OnRecover != nil {
+			monitor.opts.OnRecover(threshold.Dir, threshold.Metric, value)
+		}
+	}
+}
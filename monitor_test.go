@@ -0,0 +1,96 @@
+package fswatcher_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/raomuyang/fswatcher"
+	"github.com/raomuyang/fswatcher/fswatchertest"
+)
+
+func TestMonitor(t *testing.T) {
+	tree := fswatchertest.NewTree(t, "inbox/")
+	tree.WriteFile("big", "0123456789")
+
+	alerts := make(chan string, 10)
+	report := func(kind string) func(string, fswatcher.ThresholdMetric, int64) {
+		return func(dir string, metric fswatcher.ThresholdMetric, value int64) {
+			rel, _ := filepath.Rel(tree.Root, dir)
+			alerts <- fmt.Sprintf("%s %s %s %d", kind, filepath.ToSlash(rel), metric, value)
+		}
+	}
+	monitor, err := fswatcher.NewMonitor(tree.Root, fswatcher.MonitorOptions{
+		Thresholds: []fswatcher.Threshold{
+			{Dir: tree.Path("inbox"), Metric: fswatcher.ThresholdFiles, Limit: 2},
+			{Dir: tree.Root, Metric: fswatcher.ThresholdBytes, Limit: 5},
+		},
+		OnThreshold: report("threshold"),
+		OnRecover:   report("recover"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer monitor.Stop()
+
+	expect := func(expected string) {
+		t.Helper()
+		select {
+		case alert := <-alerts:
+			if alert != expected {
+				t.Fatalf("expected %q, got %q", expected, alert)
+			}
+		case <-time.After(timeout):
+			t.Fatalf("timeout waiting for %q", expected)
+		}
+	}
+	expect("threshold . bytes 10")
+	// the tree is scanned when NewMonitor returns
+	if node, ok := monitor.Tree().Lookup(tree.Path("big")); !ok || node.Size != 10 {
+		t.Errorf("unexpected node %+v", node)
+	}
+
+	tree.Remove("big")
+	expect("recover . bytes 0")
+
+	tree.WriteFile("inbox/a", "")
+	tree.WriteFile("inbox/b", "")
+	tree.WriteFile("inbox/c", "")
+	expect("threshold inbox files 3")
+
+	tree.Remove("inbox/a")
+	expect("recover inbox files 2")
+
+	select {
+	case alert := <-alerts:
+		t.Errorf("unexpected %q", alert)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMonitor_WatchOptions(t *testing.T) {
+	tree := fswatchertest.NewTree(t, ".git/", ".git/objects", "a/", "a/b/", "a/b/deep", "a/file", "top")
+	monitor, err := fswatcher.NewMonitor(tree.Root, fswatcher.MonitorOptions{
+		Options: []fswatcher.Option{fswatcher.WithIgnoreHidden(), fswatcher.WithMaxDepth(1)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer monitor.Stop()
+
+	// the hidden files and the files below the deepest folder watched are not counted
+	if node, ok := monitor.Tree().Lookup(tree.Root); !ok || node.Files != 2 {
+		t.Errorf("expected 2 files, got %+v", node)
+	}
+	sparse, err := fswatcher.NewMonitor(tree.Root, fswatcher.MonitorOptions{
+		Options: []fswatcher.Option{fswatcher.WithSparseWatch("a/**/deep")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sparse.Stop()
+	if node, ok := sparse.Tree().Lookup(tree.Root); !ok || node.Files != 1 {
+		t.Errorf("expected 1 file, got %+v", node)
+	}
+}
@@ -0,0 +1,103 @@
+package fswatcher
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Mux routes events to handlers by path pattern. Paths are matched relative to the root
+// of the Mux, with forward slashes. In a pattern, * matches any sequence of characters
+// except /, ? a single character except /, ** any sequence of path elements ("a/**/b"
+// matches "a/b" as well), [abc] a character class ([!abc] a negated one) and {a,b}
+// one of the alternatives, which may contain other patterns.
+// When several patterns match, the most specific one wins: the one with the most literal
+// characters, then the fewest ** and wildcards, then the first registered.
+type Mux struct {
+	root     string
+	mutex    sync.RWMutex
+	routes   []*route
+	fallback Handler
+}
+
+type route struct {
+	glob    *glob
+	handler Handler
+}
+
+// A Mux for the events of the DeepWatch of root
+func NewMux(root string) *Mux {
+	return &Mux{root: filepath.Clean(root)}
+}
+
+// Route the events whose path matches pattern to handler. Panics if the pattern is invalid,
+// see Add.
+func (mux *Mux) Handle(pattern string, handler Handler) {
+	if err := mux.Add(pattern, handler); err != nil {
+		panic(err)
+	}
+}
+
+// Route the events whose path matches pattern to handler, returns an error if the pattern
+// is invalid
+func (mux *Mux) Add(pattern string, handler Handler) error {
+	g, err := compileGlob(pattern)
+	if err != nil {
+		return err
+	}
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+	mux.routes = append(mux.routes, &route{glob: g, handler: handler})
+	return nil
+}
+
+// Route the events whose path matches pattern to fn
+func (mux *Mux) HandleFunc(pattern string, fn func(event Event) error) {
+	mux.Handle(pattern, HandlerFunc(fn))
+}
+
+// Receive the events matching no pattern
+func (mux *Mux) Fallback(handler Handler) {
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+	mux.fallback = handler
+}
+
+// The Handler routing the events, to pass to Handle
+func (mux *Mux) Handler() Handler {
+	return HandlerFunc(mux.dispatch)
+}
+
+// The handler for path, nil if there is none
+func (mux *Mux) Match(path string) Handler {
+	rel := mux.rel(path)
+
+	mux.mutex.RLock()
+	defer mux.mutex.RUnlock()
+	var best *route
+	for _, r := range mux.routes {
+		if r.glob.match(rel) && (best == nil || r.glob.moreSpecific(best.glob)) {
+			best = r
+		}
+	}
+	if best != nil {
+		return best.handler
+	}
+	return mux.fallback
+}
+
+func (mux *Mux) dispatch(event Event) error {
+	handler := mux.Match(event.Path)
+	if handler == nil {
+		return ErrUnhandled
+	}
+	return handler.Handle(event)
+}
+
+func (mux *Mux) rel(path string) string {
+	rel, err := filepath.Rel(mux.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = path
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,90 @@
+package fswatcher
+
+import (
+	"testing"
+)
+
+func TestGlob(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"*.md", "a.md", true},
+		{"*.md", "a/b.md", false},
+		{"**/*.md", "a.md", true},
+		{"**/*.md", "a/b/c.md", true},
+		{"assets/**/*.{png,jpg}", "assets/a.jpg", true},
+		{"assets/**/*.{png,jpg}", "assets/x/y/a.png", true},
+		{"assets/**/*.{png,jpg}", "assets/a.gif", false},
+		{"assets/**/*.{png,jpg}", "other/assets/a.png", false},
+		{"docs/**", "docs", true},
+		{"docs/**", "docs/a/b", true},
+		{"docs/**", "docsx", false},
+		{"file?.[!a-c]xt", "file1.txt", true},
+		{"file?.[!a-c]xt", "file1.bxt", false},
+		{"a{b,c{d,e}}", "ace", true},
+		{"a.b", "axb", false},
+	}
+	for _, c := range cases {
+		g, err := compileGlob(c.pattern)
+		if err != nil {
+			t.Fatalf("%s: %s", c.pattern, err)
+		}
+		if g.match(c.path) != c.match {
+			t.Errorf("%s on %s: expected %v", c.pattern, c.path, c.match)
+		}
+	}
+
+	for _, invalid := range []string{"a{b", "a}", "[ab"} {
+		if _, err := compileGlob(invalid); err == nil {
+			t.Errorf("%s: expected an error", invalid)
+		}
+	}
+}
+
+func TestMux(t *testing.T) {
+	md, docs, img, fallback := &handled{}, &handled{}, &handled{}, &handled{}
+	mux := NewMux("/root")
+	mux.Handle("**/*.md", md)
+	mux.Handle("docs/**/*.md", docs)
+	mux.Handle("assets/**/*.{png,jpg}", img)
+
+	if err := mux.Handler().Handle(Event{Op: Create, Path: "/root/a.txt"}); err != ErrUnhandled {
+		t.Errorf("expected unhandled without fallback, got %v", err)
+	}
+	mux.Fallback(fallback)
+
+	for _, path := range []string{"/root/a.md", "/root/docs/x/b.md", "/root/assets/c.png", "/root/d.txt"} {
+		mux.Handler().Handle(Event{Op: Write, Path: path})
+	}
+	expect := func(h *handled, events ...string) {
+		t.Helper()
+		got := h.get()
+		if len(got) != len(events) {
+			t.Errorf("expected %v, got %v", events, got)
+			return
+		}
+		for i := range events {
+			if got[i] != events[i] {
+				t.Errorf("expected %v, got %v", events, got)
+			}
+		}
+	}
+	expect(md, "WRITE /root/a.md")
+	expect(docs, "WRITE /root/docs/x/b.md")
+	expect(img, "WRITE /root/assets/c.png")
+	expect(fallback, "WRITE /root/d.txt")
+}
+
+func TestMux_InvalidPattern(t *testing.T) {
+	mux := NewMux("/root")
+	for _, pattern := range []string{"[a", "{a,b", "a}"} {
+		if err := mux.Add(pattern, HandlerFunc(func(Event) error { return nil })); err == nil {
+			t.Errorf("expected an error for %q", pattern)
+		}
+	}
+	if mux.Match("/root/a") != nil {
+		t.Error("expected the invalid patterns not to be registered")
+	}
+}
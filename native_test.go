@@ -0,0 +1,79 @@
+//go:build linux
+// +build linux
+
+package fswatcher_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/raomuyang/fswatcher"
+	"github.com/raomuyang/fswatcher/fswatchertest"
+)
+
+func TestNativeBackend(t *testing.T) {
+	tree := fswatchertest.NewTree(t, "a/", "b/")
+	recorder := fswatchertest.NewRecorder(tree.Root)
+
+	dw, err := fswatcher.Handle(tree.Root, recorder, fswatcher.WithNativeBackend())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dw.Stop()
+
+	tree.WriteFile("a/f", "data")
+	recorder.ExpectEvents(t, timeout,
+		fswatchertest.Create("a/f"), fswatchertest.Write("a/f"), fswatchertest.CloseWrite("a/f"))
+
+	if err := os.Chmod(tree.Path("a/f"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	recorder.ExpectEvents(t, timeout, fswatchertest.Attrib("a/f"))
+
+	tree.Rename("a/f", "a/g")
+	recorder.ExpectEvents(t, timeout, fswatchertest.Rename("a/f"), fswatchertest.Moved("a/f", "a/g"))
+
+	tree.Mkdir("a/c")
+	recorder.ExpectEvents(t, timeout, fswatchertest.Create("a/c"))
+	tree.WriteFile("a/c/d", "")
+	recorder.ExpectEvents(t, timeout, fswatchertest.Create("a/c/d"), fswatchertest.CloseWrite("a/c/d"))
+
+	tree.Remove("a")
+	recorder.ExpectEvents(t, timeout, fswatchertest.Remove("a"))
+
+	stats := dw.Stats()
+	if stats.Events["close_write"] == 0 {
+		t.Errorf("expected close_write events to be counted, got %v", stats.Events)
+	}
+	if stats.Events["attrib"] == 0 || stats.Events["chmod"] != 0 {
+		t.Errorf("expected attrib events to be counted as attrib only, got %v", stats.Events)
+	}
+}
+
+func TestNativeBackend_PauseResume(t *testing.T) {
+	tree := fswatchertest.NewTree(t, "a/")
+	recorder := fswatchertest.NewRecorder(tree.Root)
+
+	dw, err := fswatcher.Handle(tree.Root, recorder, fswatcher.WithNativeBackend())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dw.Stop()
+
+	dw.Pause()
+	tree.WriteFile("a/f", "data")
+	if err := os.Chmod(tree.Path("a/f"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tree.Remove("a/f")
+	tree.WriteFile("a/g", "data")
+	if err := os.Chmod(tree.Path("a/g"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	recorder.ExpectNoEvents(t, 200*time.Millisecond)
+
+	dw.Resume(fswatcher.ResumeReplay)
+	recorder.ExpectEvents(t, timeout, fswatchertest.Create("a/g"))
+	recorder.ExpectNoEvents(t, 200*time.Millisecond)
+}
@@ -0,0 +1,157 @@
+package fswatcher
+
+import "time"
+
+// Option configures a watch, see Watch
+type Option func(opts *options)
+
+type options struct {
+	registry *Registry
+	logger   Logger
+	recorder *Recorder
+	follow   bool
+	wait     bool
+	native   bool
+	maxDepth int
+	sparse   []string
+	scan     bool
+	hidden   bool
+	workers  int
+	progress func(Progress)
+	policy   WatchPolicy
+	retry    time.Duration
+}
+
+func newOptions(opts []Option) options {
+	o := options{logger: NopLogger, maxDepth: -1, workers: 1, retry: defaultRetryInterval}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Register the watcher metrics in the given registry instead of a private one,
+// so that they can be exposed together with the application metrics
+func WithRegistry(registry *Registry) Option {
+	return func(opts *options) {
+		opts.registry = registry
+	}
+}
+
+// Send the log output of the watchers to logger, by default nothing is logged
+func WithLogger(logger Logger) Option {
+	return func(opts *options) {
+		if logger == nil {
+			logger = NopLogger
+		}
+		opts.logger = logger
+	}
+}
+
+// Record every event delivered to the callable
+func WithRecorder(recorder *Recorder) Option {
+	return func(opts *options) {
+		opts.recorder = recorder
+	}
+}
+
+// Follow a file by name: keep watching when it is removed or renamed, and report a
+// Recreate event when the path appears again (log rotation, atomic replacement).
+// Only applies when the target is a file.
+func WithFollow() Option {
+	return func(opts *options) {
+		opts.follow = true
+	}
+}
+
+// Accept a target which does not exist yet: its nearest existing ancestor is watched until
+// the target is created, then the target is watched as usual and a Create event is reported for it
+func WithWaitForCreation() Option {
+	return func(opts *options) {
+		opts.wait = true
+	}
+}
+
+// Read the notifications of the operating system directly instead of through fsnotify, which
+// reports more: CloseWrite when a file opened for writing is closed, Attrib, Overflow when
+// events were lost, and the OldPath of moved files. Only available on Linux (inotify),
+// Watch fails elsewhere.
+func WithNativeBackend() Option {
+	return func(opts *options) {
+		opts.native = true
+	}
+}
+
+// Only watch the folders up to depth levels below the root: 0 watches the root folder only,
+// 1 its sub folders as well, and so on. Negative for no limit, the default.
+func WithMaxDepth(depth int) Option {
+	return func(opts *options) {
+		opts.maxDepth = depth
+	}
+}
+
+// Only watch the folders which may contain paths matching one of the patterns (relative to
+// the root, see Mux for the syntax), or such folders later, then only deliver the events of
+// the matching paths. For "services/*/migrations/*.sql", the root, "services", its sub folders
+// and their "migrations" folders are watched. A "**" may lead to any folder below it, which is
+// watched: for "**/migrations/*.sql" every folder is watched, and only the events of the
+// matching files are delivered. Only applies when the target is a folder.
+func WithSparseWatch(patterns ...string) Option {
+	return func(opts *options) {
+		opts.sparse = append(opts.sparse, patterns...)
+	}
+}
+
+// Report an Existing event for each file and folder present when the watch starts, then a
+// Ready event for the root. The events received meanwhile are delivered after Ready, so that
+// they apply on top of the scanned state; a Create of a path already reported Existing is
+// dropped. With WithWaitForCreation, the scan starts when the root is created.
+func WithInitialScan() Option {
+	return func(opts *options) {
+		opts.scan = true
+	}
+}
+
+// Ignore the files and folders below the root whose name starts with a dot, and everything
+// they contain: they are neither watched, scanned nor reported
+func WithIgnoreHidden() Option {
+	return func(opts *options) {
+		opts.hidden = true
+	}
+}
+
+// Watch the folders of the tree with up to n goroutines, in the background: Watch returns
+// before the tree is covered, see DeepWatch.Ready. The sparse traversal stays serial
+// (see WithSparseWatch).
+func WithWorkers(n int) Option {
+	return func(opts *options) {
+		if n < 1 {
+			n = 1
+		}
+		opts.workers = n
+	}
+}
+
+// Report the progress of the traversal of the tree when the watch starts, at most every
+// 100ms from the traversal goroutines, and once more when it is complete
+func WithProgress(fn func(Progress)) Option {
+	return func(opts *options) {
+		opts.progress = fn
+	}
+}
+
+// What to do when a folder cannot be watched, BestEffort by default
+func WithWatchPolicy(policy WatchPolicy) Option {
+	return func(opts *options) {
+		opts.policy = policy
+	}
+}
+
+// How often the paths not watched are tried again with RetryFailed, 30s by default
+func WithRetryInterval(interval time.Duration) Option {
+	return func(opts *options) {
+		if interval > 0 {
+			opts.retry = interval
+		}
+	}
+}
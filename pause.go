@@ -0,0 +1,153 @@
+package fswatcher
+
+// What to do with the events received while a DeepWatch was paused
+type ResumeMode int
+
+const (
+	// Drop the events received while paused
+	ResumeDiscard ResumeMode = iota
+	// Deliver the net changes received while paused: writes, close-writes and attribute changes
+	// are merged, keeping CloseWrite when the last write completed, and a file created then
+	// removed while paused is not reported at all
+	ResumeReplay
+)
+
+// Stop delivering events until Resume. The watchers keep running while paused, so that new
+// folders are still watched and the events can be replayed.
+func (dw *DeepWatch) Pause() {
+	dw.mutex.Lock()
+	defer dw.mutex.Unlock()
+	if !dw.paused {
+		dw.paused = true
+		dw.pending = newPendingEvents()
+	}
+}
+
+// Deliver events again, mode chooses what happens to the events received while paused.
+// Replayed events are delivered before any new event, in the order their path first changed.
+// Resume must not be called from a callback.
+func (dw *DeepWatch) Resume(mode ResumeMode) {
+	dw.delivery.Lock()
+	defer dw.delivery.Unlock()
+
+	dw.mutex.Lock()
+	if !dw.paused {
+		dw.mutex.Unlock()
+		return
+	}
+	dw.paused = false
+	pending := dw.pending
+	dw.pending = nil
+	dw.mutex.Unlock()
+
+	if mode != ResumeReplay {
+		for i := 0; i < pending.received; i++ {
+			dw.metrics.drop()
+		}
+		return
+	}
+
+	events := pending.events()
+	for i := len(events); i < pending.received; i++ {
+		dw.metrics.coalesce()
+	}
+	for _, event := range events {
+		dw.dispatch(event)
+	}
+}
+
+// Whether the watch is paused
+func (dw *DeepWatch) Paused() bool {
+	dw.mutex.Lock()
+	defer dw.mutex.Unlock()
+	return dw.paused
+}
+
+// The events received while paused, merged by path
+type pendingEvents struct {
+	received int
+	order    []string
+	byPath   map[string][]Event
+}
+
+func newPendingEvents() *pendingEvents {
+	return &pendingEvents{byPath: make(map[string][]Event)}
+}
+
+func (pending *pendingEvents) add(event Event) {
+	pending.received++
+
+	seq, seen := pending.byPath[event.Path]
+	if !seen {
+		pending.order = append(pending.order, event.Path)
+	}
+	pending.byPath[event.Path] = coalesce(seq, event)
+}
+
+// Merge event into the changes of its path, the result has at most two events:
+// a removal followed by a creation or a modification
+func coalesce(seq []Event, event Event) []Event {
+	last := Op(0)
+	if len(seq) > 0 {
+		last = seq[len(seq)-1].Op
+	}
+
+	switch event.Op {
+	case Create:
+		if last == Create {
+			seq[len(seq)-1].Time = event.Time
+			return seq
+		}
+	case Write, CloseWrite, Attrib:
+		if last == Create {
+			seq[len(seq)-1].Time = event.Time
+			return seq
+		}
+		if modification(last) > 0 {
+			// the strongest modification is kept, the last of a write and a close-write: a
+			// completed write ends with CloseWrite, a write started again ends with Write
+			if modification(event.Op) >= modification(last) {
+				seq[len(seq)-1] = event
+			} else {
+				seq[len(seq)-1].Time = event.Time
+			}
+			return seq
+		}
+	case Remove, Rename:
+		if modification(last) > 0 {
+			seq = seq[:len(seq)-1]
+			last = Op(0)
+			if len(seq) > 0 {
+				last = seq[len(seq)-1].Op
+			}
+		}
+		if last == Create {
+			// created while paused, or removed then created again: the net change
+			// is whatever happened before the creation
+			return seq[:len(seq)-1]
+		}
+		if last == Remove || last == Rename {
+			return seq
+		}
+	}
+	return append(seq, event)
+}
+
+// The rank of the modifications of an existing path, 0 for the other operations
+func modification(op Op) int {
+	switch op {
+	case Attrib:
+		return 1
+	case Write, CloseWrite:
+		return 2
+	}
+	return 0
+}
+
+func (pending *pendingEvents) events() []Event {
+	var events []Event
+	for _, path := range pending.order {
+		events = append(events, pending.byPath[path]...)
+	}
+	return events
+}
@@ -0,0 +1,148 @@
+package fswatcher
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPendingEvents(t *testing.T) {
+	pending := newPendingEvents()
+	for _, event := range []Event{
+		{Op: Create, Path: "a"},
+		{Op: Write, Path: "a"},
+		{Op: Write, Path: "b"},
+		{Op: Create, Path: "c"},
+		{Op: Write, Path: "a"},
+		{Op: Remove, Path: "c"},
+		{Op: Remove, Path: "d"},
+		{Op: Create, Path: "d"},
+		{Op: Write, Path: "d"},
+		{Op: Write, Path: "e"},
+		{Op: Rename, Path: "e"},
+	} {
+		pending.add(event)
+	}
+
+	var got []string
+	for _, event := range pending.events() {
+		got = append(got, event.String())
+	}
+	expected := []string{"CREATE a", "WRITE b", "REMOVE d", "CREATE d", "RENAME e"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if pending.received != 11 {
+		t.Errorf("expected 11 received events, got %d", pending.received)
+	}
+}
+
+func TestPendingEvents_Native(t *testing.T) {
+	pending := newPendingEvents()
+	for _, event := range []Event{
+		{Op: Create, Path: "a"},
+		{Op: Write, Path: "a"},
+		{Op: CloseWrite, Path: "a"},
+		{Op: Attrib, Path: "a"},
+		{Op: Remove, Path: "a"},
+		{Op: Attrib, Path: "b"},
+		{Op: Write, Path: "b"},
+		{Op: CloseWrite, Path: "b"},
+		{Op: Remove, Path: "c"},
+		{Op: Create, Path: "c"},
+		{Op: CloseWrite, Path: "c"},
+		{Op: Attrib, Path: "c"},
+		{Op: Attrib, Path: "d"},
+		{Op: CloseWrite, Path: "d"},
+		{Op: Rename, Path: "d"},
+		{Op: CloseWrite, Path: "e"},
+		{Op: Write, Path: "e"},
+	} {
+		pending.add(event)
+	}
+
+	var got []string
+	for _, event := range pending.events() {
+		got = append(got, event.String())
+	}
+	expected := []string{"CLOSE_WRITE b", "REMOVE c", "CREATE c", "RENAME d", "WRITE e"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+type eventList struct {
+	mutex  sync.Mutex
+	events []string
+}
+
+func (list *eventList) add(op string) func(string) {
+	return func(filePath string) {
+		list.mutex.Lock()
+		defer list.mutex.Unlock()
+		list.events = append(list.events, op+" "+filePath)
+	}
+}
+
+func (list *eventList) get() []string {
+	list.mutex.Lock()
+	defer list.mutex.Unlock()
+	return append([]string(nil), list.events...)
+}
+
+func TestDeepWatch_PauseResume(t *testing.T) {
+	root := ".test-pause"
+	os.MkdirAll(root, os.ModePerm)
+	defer os.RemoveAll(root)
+
+	list := &eventList{}
+	dw, err := Watch(root, Callable{
+		OnCreate: list.add("CREATE"),
+		OnWrite:  list.add("WRITE"),
+		OnRemove: list.add("REMOVE"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dw.Stop()
+
+	a := filepath.Join(root, "a")
+	b := filepath.Join(root, "b")
+	f, _ := os.Create(b)
+	f.Close()
+	<-time.After(200 * time.Millisecond)
+
+	dw.Pause()
+	if !dw.Paused() {
+		t.Error("expected paused")
+	}
+	f, _ = os.Create(a)
+	f.WriteString("a")
+	f.Close()
+	f, _ = os.OpenFile(b, os.O_WRONLY, 0)
+	f.WriteString("b")
+	f.Close()
+	os.Remove(b)
+	<-time.After(200 * time.Millisecond)
+	expected := []string{"CREATE " + b}
+	if events := list.get(); !reflect.DeepEqual(events, expected) {
+		t.Errorf("events delivered while paused: %v", events)
+	}
+
+	dw.Resume(ResumeReplay)
+	expected = append(expected, "CREATE "+a, "REMOVE "+b)
+	if events := list.get(); !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %v, got %v", expected, events)
+	}
+
+	dw.Pause()
+	os.Remove(a)
+	<-time.After(200 * time.Millisecond)
+	dw.Resume(ResumeDiscard)
+	if events := list.get(); !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %v, got %v", expected, events)
+	}
+}
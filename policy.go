@@ -0,0 +1,145 @@
+package fswatcher
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// What to do when a folder of the tree cannot be watched, see WithWatchPolicy
+type WatchPolicy int
+
+const (
+	// Keep watching the rest of the tree, the paths not watched are listed by DeepWatch.Errors
+	BestEffort WatchPolicy = iota
+	// Stop the watch at the first failure while the watch starts: Watch returns the WatchErrors,
+	// or with WithWorkers the watch stops and DeepWatch.Errors lists them
+	FailFast
+	// Keep watching the rest of the tree and try the paths not watched again periodically,
+	// see WithRetryInterval
+	RetryFailed
+)
+
+const defaultRetryInterval = 30 * time.Second
+
+// A path which could not be watched ("watch"), listed ("list") or read ("stat"): the folders
+// below it are not watched, or not scanned by a Tree
+type PathError struct {
+	Op   string
+	Path string
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	return e.Op + " " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *PathError) Cause() error {
+	return e.Err
+}
+
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+// The paths of a watched tree which could not be watched, sorted by path
+type WatchErrors []*PathError
+
+// At most that many paths in the message of WatchErrors
+const maxErrorsListed = 10
+
+func (errs WatchErrors) Error() string {
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+	messages := make([]string, 0, maxErrorsListed+1)
+	for i, err := range errs {
+		if i == maxErrorsListed {
+			messages = append(messages, fmt.Sprintf("and %d more", len(errs)-i))
+			break
+		}
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf("%d paths not watched: %s", len(errs), strings.Join(messages, "; "))
+}
+
+// The paths of the tree which are not watched because of an error, nil when the whole
+// tree is watched
+func (dw *DeepWatch) Errors() WatchErrors {
+	dw.mutex.Lock()
+	defer dw.mutex.Unlock()
+	return sortErrors(dw.failures)
+}
+
+func sortErrors(failures map[string]*PathError) WatchErrors {
+	if len(failures) == 0 {
+		return nil
+	}
+	errs := make(WatchErrors, 0, len(failures))
+	for _, err := range failures {
+		errs = append(errs, err)
+	}
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Path < errs[j].Path
+	})
+	return errs
+}
+
+// Record that path could not be watched or listed, and stop the watch if it is starting
+// with FailFast
+func (dw *DeepWatch) fail(op, path string, err error) {
+	if os.IsNotExist(err) {
+		// removed meanwhile, its removal is reported
+		return
+	}
+	dw.logger.Warnf("Cannot %s %s: %s", op, path, err)
+	dw.progress.add(0, 0, 1)
+
+	dw.mutex.Lock()
+	dw.failures[path] = &PathError{Op: op, Path: path, Err: err}
+	dw.mutex.Unlock()
+
+	if dw.opts.policy == FailFast {
+		select {
+		case <-dw.ready:
+		default:
+			dw.Stop()
+		}
+	}
+}
+
+// Watch the failed paths again every retry interval, until the watch stops
+func (dw *DeepWatch) retry() {
+	ticker := time.NewTicker(dw.opts.retry)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-dw.done:
+			return
+		case <-ticker.C:
+		}
+		for _, err := range dw.Errors() {
+			info, statErr := os.Lstat(err.Path)
+			if os.IsNotExist(statErr) {
+				// removed meanwhile
+				dw.unwatch(err.Path)
+				continue
+			} else if statErr != nil {
+				continue
+			}
+			// recorded again if it fails again
+			dw.mutex.Lock()
+			delete(dw.failures, err.Path)
+			dw.mutex.Unlock()
+
+			dw.logger.Infof("Retry watching %s", err.Path)
+			if info.IsDir() {
+				dw.watchMissing(err.Path)
+			} else if !dw.watched(err.Path) {
+				dw.watchPath(err.Path)
+			}
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package fswatcher
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestWatchErrors(t *testing.T) {
+	var errs WatchErrors
+	for i := 0; i < 12; i++ {
+		errs = append(errs, &PathError{Op: "watch", Path: "/a" + strings.Repeat("/b", i), Err: syscall.ENOSPC})
+	}
+	if message := errs[:1].Error(); message != "watch /a: no space left on device" {
+		t.Errorf("unexpected message %q", message)
+	}
+	message := errs.Error()
+	if !strings.HasPrefix(message, "12 paths not watched: watch /a: no space left on device; watch /a/b: ") ||
+		!strings.HasSuffix(message, "; and 2 more") {
+		t.Errorf("unexpected message %q", message)
+	}
+	if errors.Cause(errs[0]) != syscall.ENOSPC {
+		t.Error("expected the cause of the error")
+	}
+}
+
+func TestDeepWatch_Errors(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a/b", "c"} {
+		os.MkdirAll(filepath.Join(root, dir), os.ModePerm)
+	}
+	dw, err := Watch(root, Callable{}, WithWatchPolicy(RetryFailed), WithRetryInterval(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dw.Stop()
+	if errs := dw.Errors(); errs != nil {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+
+	dw.fail("watch", filepath.Join(root, "c"), syscall.ENOSPC)
+	dw.fail("list", filepath.Join(root, "a"), syscall.EACCES)
+	dw.fail("watch", filepath.Join(root, "gone"), os.ErrNotExist)
+	errs := dw.Errors()
+	if len(errs) != 2 || errs[0].Path != filepath.Join(root, "a") || errs[0].Op != "list" || errs[1].Err != syscall.ENOSPC {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+
+	// the failed paths are watched again
+	deadline := time.Now().Add(3 * time.Second)
+	for dw.Errors() != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the paths to be retried, got %v", dw.Errors())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the errors of a removed path are forgotten
+	dw.fail("watch", filepath.Join(root, "a", "b"), syscall.ENOSPC)
+	dw.unwatch(filepath.Join(root, "a"))
+	if errs := dw.Errors(); errs != nil {
+		t.Errorf("unexpected errors %v", errs)
+	}
+}
+
+// A folder which cannot be listed, below root
+func lockedFolder(t *testing.T, root string) string {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("needs permissions to be enforced")
+	}
+	locked := filepath.Join(root, "a", "locked")
+	os.MkdirAll(locked, os.ModePerm)
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(locked, 0755) })
+	return locked
+}
+
+func TestDeepWatch_RetryFailed(t *testing.T) {
+	root := t.TempDir()
+	locked := lockedFolder(t, root)
+	dw, err := Watch(root, Callable{}, WithWatchPolicy(RetryFailed), WithRetryInterval(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dw.Stop()
+
+	// still failing after some retries, even when it cannot be stat-ed
+	parent := filepath.Dir(locked)
+	for _, mode := range []os.FileMode{0755, 0} {
+		os.Chmod(parent, mode)
+		defer os.Chmod(parent, 0755)
+		time.Sleep(200 * time.Millisecond)
+		errs := dw.Errors()
+		if len(errs) != 1 || errs[0].Op != "list" || errs[0].Path != locked || !os.IsPermission(errs[0].Err) {
+			t.Fatalf("unexpected errors %v", errs)
+		}
+	}
+
+	os.Chmod(parent, 0755)
+	os.Chmod(locked, 0755)
+	deadline := time.Now().Add(3 * time.Second)
+	for dw.Errors() != nil || !dw.watched(locked) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %s to be watched, got %v", locked, dw.Errors())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDeepWatch_FailFast(t *testing.T) {
+	root := t.TempDir()
+	locked := lockedFolder(t, root)
+	dw, err := Watch(root, Callable{}, WithWatchPolicy(FailFast))
+	if dw != nil {
+		dw.Stop()
+		t.Error("expected no watch")
+	}
+	errs, ok := err.(WatchErrors)
+	if !ok {
+		t.Fatalf("expected WatchErrors, got %v", err)
+	}
+	if len(errs) != 1 || errs[0].Op != "list" || errs[0].Path != locked || !os.IsPermission(errs[0].Err) {
+		t.Errorf("unexpected errors %v", errs)
+	}
+}
+
+func TestDeepWatch_FailFastWaiting(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "root")
+	dw, err := Watch(root, Callable{}, WithWaitForCreation(), WithWatchPolicy(FailFast))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dw.Stop()
+
+	// the tree is not covered yet
+	dw.fail("watch", root, syscall.ENOSPC)
+	select {
+	case <-dw.Stopped():
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected the watch to stop")
+	}
+	if errs := dw.Errors(); len(errs) != 1 || errs[0].Path != root {
+		t.Errorf("unexpected errors %v", errs)
+	}
+}
@@ -0,0 +1,66 @@
+package fswatcher
+
+import (
+	"sync"
+	"time"
+)
+
+// The progress of the traversal of the tree when a watch starts, see WithProgress
+type Progress struct {
+	// folders listed
+	Dirs int
+	// folders watched
+	Watches int
+	// folders which could not be watched or listed
+	Errors int
+	// the traversal is complete, the last report
+	Done bool
+}
+
+const progressInterval = 100 * time.Millisecond
+
+// Counts the progress of the traversal and reports it to fn. All methods accept a nil
+// receiver, when no progress is reported.
+type progressReporter struct {
+	fn       func(Progress)
+	mutex    sync.Mutex
+	progress Progress
+	reported time.Time
+}
+
+func newProgressReporter(fn func(Progress)) *progressReporter {
+	if fn == nil {
+		return nil
+	}
+	return &progressReporter{fn: fn, reported: time.Now()}
+}
+
+func (r *progressReporter) add(dirs, watches, errors int) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.progress.Done {
+		return
+	}
+	r.progress.Dirs += dirs
+	r.progress.Watches += watches
+	r.progress.Errors += errors
+	if time.Since(r.reported) >= progressInterval {
+		r.reported = time.Now()
+		r.fn(r.progress)
+	}
+}
+
+func (r *progressReporter) done() {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.progress.Done {
+		r.progress.Done = true
+		r.fn(r.progress)
+	}
+}
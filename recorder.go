@@ -0,0 +1,89 @@
+package fswatcher
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Recorder writes events as JSON lines, one event per line. A recording can be fed back
+// into a Callable with Replay.
+type Recorder struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+	closer  io.Closer
+}
+
+// Record into w
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{encoder: json.NewEncoder(w)}
+}
+
+// Record into file, appending when it exists
+func CreateRecorder(file string) (*Recorder, error) {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	recorder := NewRecorder(f)
+	recorder.closer = f
+	return recorder, nil
+}
+
+// Write event as a line
+func (recorder *Recorder) Record(event Event) error {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	return recorder.encoder.Encode(event)
+}
+
+// Close the file of a recorder created with CreateRecorder
+func (recorder *Recorder) Close() error {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	if recorder.closer == nil {
+		return nil
+	}
+	err := recorder.closer.Close()
+	recorder.closer = nil
+	return err
+}
+
+// Feed the events recorded in file to callable. speed scales the original pace of the
+// events (2 replays twice as fast), events are delivered without delay when speed <= 0.
+func Replay(file string, callable Callable, speed float64) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return ReplayFrom(f, callable, speed)
+}
+
+// Same as Replay, reading the recording from r
+func ReplayFrom(r io.Reader, callable Callable, speed float64) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var last time.Time
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return errors.Wrapf(err, "line %d", line)
+		}
+		if speed > 0 && !last.IsZero() && event.Time.After(last) {
+			time.Sleep(time.Duration(float64(event.Time.Sub(last)) / speed))
+		}
+		last = event.Time
+		callable.dispatch(event)
+	}
+	return scanner.Err()
+}
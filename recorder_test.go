@@ -0,0 +1,79 @@
+package fswatcher
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecorder_Replay(t *testing.T) {
+	buf := &bytes.Buffer{}
+	recorder := NewRecorder(buf)
+	start := time.Now()
+	recorder.Record(Event{Op: Create, Path: "a", Time: start})
+	recorder.Record(Event{Op: Write, Path: "a", Time: start.Add(100 * time.Millisecond),
+		Meta: map[string]string{"k": "v"}})
+	recorder.Record(Event{Op: Rename, Path: "b", OldPath: "a", Time: start.Add(200 * time.Millisecond)})
+
+	if !strings.Contains(buf.String(), `"op":"RENAME","path":"b","old_path":"a"`) {
+		t.Errorf("unexpected recording: %s", buf.String())
+	}
+
+	list := &eventList{}
+	callable := Callable{
+		OnCreate: list.add("CREATE"),
+		OnWrite:  list.add("WRITE"),
+		OnRename: list.add("RENAME"),
+	}
+	begin := time.Now()
+	if err := ReplayFrom(bytes.NewReader(buf.Bytes()), callable, 2); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(begin); elapsed < 100*time.Millisecond {
+		t.Errorf("replay too fast: %s", elapsed)
+	}
+	expected := []string{"CREATE a", "WRITE a", "RENAME b"}
+	if events := list.get(); !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %v, got %v", expected, events)
+	}
+
+	if err := ReplayFrom(strings.NewReader(`{"op":"CHOWN","path":"a"}`), callable, 0); err == nil {
+		t.Error("expected unknown op error")
+	}
+}
+
+func TestWithRecorder(t *testing.T) {
+	root := ".test-recorder"
+	os.MkdirAll(root, os.ModePerm)
+	defer os.RemoveAll(root)
+
+	file := filepath.Join(root, "..", ".test-recorder.jsonl")
+	defer os.Remove(file)
+	recorder, err := CreateRecorder(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dw, err := Watch(root, Callable{}, WithRecorder(recorder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := filepath.Join(root, "a")
+	f, _ := os.Create(a)
+	f.Close()
+	<-time.After(200 * time.Millisecond)
+	dw.Stop()
+	<-dw.Stopped()
+	recorder.Close()
+
+	list := &eventList{}
+	if err := Replay(file, Callable{OnCreate: list.add("CREATE")}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if events := list.get(); len(events) == 0 || events[0] != "CREATE "+a {
+		t.Errorf("unexpected replay: %v", events)
+	}
+}
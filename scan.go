@@ -0,0 +1,70 @@
+package fswatcher
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Report an Existing event for each path of the watched tree, then Ready, then the events
+// held meanwhile, see WithInitialScan. The folders are watched before they are listed, so
+// that a change is either seen by the scan or held.
+func (dw *DeepWatch) scan() {
+	existing := make(map[string]bool)
+	err := filepath.Walk(dw.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// removed meanwhile, its Remove event is held
+			return nil
+		}
+		if dw.isStopped() {
+			return errStopped
+		}
+		if path != dw.root || !info.IsDir() {
+			event := Event{Op: Existing, Path: path, Time: time.Now()}
+			if !dw.excluded(event) {
+				existing[path] = true
+				dw.send(event)
+			}
+		}
+		if info.IsDir() && !dw.watched(path) {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err == errStopped {
+		return
+	}
+	dw.send(Event{Op: Ready, Path: dw.root, Time: time.Now()})
+
+	// the held events arriving while the previous ones are sent are held as well
+	for {
+		dw.mutex.Lock()
+		held := dw.held
+		dw.held = nil
+		if len(held) == 0 {
+			dw.scanning = false
+			dw.mutex.Unlock()
+			return
+		}
+		dw.mutex.Unlock()
+
+		for _, event := range held {
+			switch {
+			case event.Op == Create && event.OldPath == "" && existing[event.Path]:
+				// created during the scan, and reported by it
+				delete(existing, event.Path)
+				dw.metrics.coalesce()
+				continue
+			case event.Op == Remove || event.Op == Rename:
+				delete(existing, event.Path)
+			}
+			dw.send(event)
+		}
+	}
+}
+
+func (dw *DeepWatch) isStopped() bool {
+	dw.mutex.Lock()
+	defer dw.mutex.Unlock()
+	return dw.stopped
+}
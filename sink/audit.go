@@ -0,0 +1,142 @@
+package sink
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/raomuyang/fswatcher"
+)
+
+// Appends the events to a file of JSON lines, each record chained to the previous one by
+// its hash:
+//
+//	{"seq":1,"event":{"op":"WRITE","path":"/etc/hosts","time":"..."},"prev":"","hash":"9f86..."}
+//
+// The hash of a record is the SHA-256 of the record without its hash, which includes the hash
+// of the previous record: a record modified, inserted or removed breaks the chain, see
+// VerifyAudit. Removing the last records is only detected by comparing the last hash with
+// a copy kept elsewhere, see Last.
+type Audit struct {
+	mutex sync.Mutex
+	file  *os.File
+	seq   uint64
+	last  string
+}
+
+type auditRecord struct {
+	Seq   uint64          `json:"seq"`
+	Event json.RawMessage `json:"event"`
+	Prev  string          `json:"prev"`
+	Hash  string          `json:"hash,omitempty"`
+}
+
+func (record auditRecord) hash() string {
+	record.Hash = ""
+	data, _ := json.Marshal(record)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Open the audit file at path to append events to it, creating it if needed. The chain of
+// an existing file is verified first.
+func OpenAudit(path string) (*Audit, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	audit := &Audit{file: file}
+	audit.seq, audit.last, err = verify(file)
+	if err != nil {
+		file.Close()
+		return nil, errors.Wrap(err, path)
+	}
+	return audit, nil
+}
+
+func (audit *Audit) Handle(event fswatcher.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	audit.mutex.Lock()
+	defer audit.mutex.Unlock()
+	record := auditRecord{Seq: audit.seq + 1, Event: data, Prev: audit.last}
+	record.Hash = record.hash()
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	// a single write: the record is either appended entirely or not at all
+	if _, err := audit.file.Write(append(line, '\n')); err != nil {
+		return errors.Wrap(err, "audit")
+	}
+	audit.seq, audit.last = record.Seq, record.Hash
+	return nil
+}
+
+// The sequence number and the hash of the last record, 0 and "" for an empty file
+func (audit *Audit) Last() (seq uint64, hash string) {
+	audit.mutex.Lock()
+	defer audit.mutex.Unlock()
+	return audit.seq, audit.last
+}
+
+// Flush the file to the disk
+func (audit *Audit) Sync() error {
+	return audit.file.Sync()
+}
+
+func (audit *Audit) Close() error {
+	return audit.file.Close()
+}
+
+// Check the chain of the audit file at path, returns the sequence number and the hash of
+// its last record. The error tells the line of the first invalid record.
+func VerifyAudit(path string) (seq uint64, hash string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+	seq, hash, err = verify(file)
+	if err != nil {
+		err = errors.Wrap(err, path)
+	}
+	return
+}
+
+func verify(r io.Reader) (seq uint64, last string, err error) {
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(data) == 0 {
+			return seq, last, nil
+		}
+		if err == io.EOF {
+			return 0, "", errors.Errorf("line %d: truncated record", line)
+		}
+		if err != nil {
+			return 0, "", err
+		}
+		var record auditRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return 0, "", errors.Wrapf(err, "line %d", line)
+		}
+		switch {
+		case record.Seq != seq+1:
+			return 0, "", errors.Errorf("line %d: sequence %d after %d", line, record.Seq, seq)
+		case record.Prev != last:
+			return 0, "", errors.Errorf("line %d: broken chain", line)
+		case record.Hash != record.hash():
+			return 0, "", errors.Errorf("line %d: invalid hash", line)
+		}
+		seq, last = record.Seq, record.Hash
+	}
+}
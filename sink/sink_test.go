@@ -0,0 +1,144 @@
+package sink
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raomuyang/fswatcher"
+)
+
+func TestSyslog(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	s, err := DialSyslog(SyslogOptions{Network: "udp", Address: conn.LocalAddr().String(), Facility: 10, AppName: "fim", Hostname: "my host"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	event := fswatcher.Event{
+		Op:      fswatcher.Create,
+		Path:    `/etc/a "b"]`,
+		OldPath: "/etc/c",
+		Time:    time.Date(2019, 6, 1, 12, 0, 0, 1000, time.UTC),
+	}
+	if err := s.Handle(event); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<85>1 2019-06-01T12:00:00.000001Z my_host fim [0-9]+ CREATE ` +
+		regexp.QuoteMeta(`[fswatcher@32473 op="CREATE" path="/etc/a \"b\"\]" old_path="/etc/c"] CREATE /etc/a "b"]`)
+	if !regexp.MustCompile("^" + expected + "$").Match(buf[:n]) {
+		t.Errorf("unexpected message %q", buf[:n])
+	}
+
+	s.Close()
+	if err := s.Handle(event); err == nil {
+		t.Error("expected an error after Close")
+	}
+}
+
+func TestSyslog_Unix(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no unix sockets")
+	}
+	dir, err := ioutil.TempDir("", "syslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	address := filepath.Join(dir, "log")
+	conn, err := net.ListenPacket("unixgram", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	s, err := DialSyslog(SyslogOptions{Network: "unixgram", Address: address})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Handle(fswatcher.Event{Op: fswatcher.Overflow}); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message := string(buf[:n]); !strings.HasPrefix(message, "<12>1 ") || !strings.Contains(message, ` OVERFLOW [fswatcher@32473 op="OVERFLOW" path=""]`) {
+		t.Errorf("unexpected message %q", message)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := OpenAudit(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if err := audit.Handle(fswatcher.Event{Op: fswatcher.Write, Path: "/etc/" + name, Time: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seq, last := audit.Last()
+	audit.Close()
+
+	// appending resumes the chain
+	audit, err = OpenAudit(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, l := audit.Last(); s != 3 || l != last {
+		t.Errorf("expected to resume after record %d %s, got %d %s", seq, last, s, l)
+	}
+	audit.Handle(fswatcher.Event{Op: fswatcher.Remove, Path: "/etc/d", Meta: map[string]string{"cookie": "1"}})
+	seq, last = audit.Last()
+	audit.Close()
+	if s, l, err := VerifyAudit(path); err != nil || s != 4 || l != last {
+		t.Fatalf("expected a valid chain of 4 records ending with %s, got %d %s %v", last, s, l, err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	tampered := map[string]string{
+		"invalid hash":    strings.Join(lines[:1], "") + strings.Replace(lines[1], "/etc/b", "/etc/x", 1) + strings.Join(lines[2:], ""),
+		"sequence 3":      strings.Join(lines[:1], "") + strings.Join(lines[2:], ""),
+		"broken chain":    strings.Join(lines[:1], "") + strings.Replace(lines[1], `"prev":"`, `"prev":"0`, 1) + strings.Join(lines[2:], ""),
+		"truncated":       string(data[:len(data)-10]),
+		"line 1: invalid": strings.Replace(string(data), `"op":"WRITE"`, `"op":"REMOVE"`, 1),
+	}
+	for message, content := range tampered {
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := VerifyAudit(path); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("expected an error with %q, got %v", message, err)
+		}
+		if _, err := OpenAudit(path); err == nil {
+			t.Errorf("%s: expected OpenAudit to refuse the file", message)
+		}
+	}
+}
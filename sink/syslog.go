@@ -0,0 +1,171 @@
+// Package sink forwards the events of a watch outside of the process: to syslog, or to an
+// audit file which can be verified for tampering. The sinks are fswatcher.Handlers:
+//
+//	audit, err := sink.OpenAudit("/var/log/fswatcher.audit")
+//	dw, err := fswatcher.Handle("/etc", audit)
+package sink
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/raomuyang/fswatcher"
+)
+
+// Options of a Syslog sink
+type SyslogOptions struct {
+	// "unixgram", "unix" or "udp", and the address of the syslog daemon.
+	// The local daemon (/dev/log...) by default.
+	Network string
+	Address string
+	// e.g. 4 (auth), 10 (authpriv), 16 (local0), 1 (user) by default
+	Facility int
+	// The name of the program by default
+	AppName  string
+	Hostname string
+}
+
+// Severities of the messages
+const (
+	severityWarning = 4
+	severityNotice  = 5
+)
+
+// Sends the events to syslog as RFC 5424 messages, the event in the structured data:
+//
+//	<13>1 2019-06-01T12:00:00.000000Z host fswatch 4242 WRITE [fswatcher@32473 op="WRITE" path="/etc/hosts"] WRITE /etc/hosts
+type Syslog struct {
+	opts   SyslogOptions
+	mutex  sync.Mutex
+	conn   net.Conn
+	closed bool
+}
+
+var localSyslogAddresses = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+func DialSyslog(opts SyslogOptions) (*Syslog, error) {
+	if opts.Facility == 0 {
+		opts.Facility = 1
+	}
+	if opts.Facility < 0 || opts.Facility > 23 {
+		return nil, errors.Errorf("invalid syslog facility: %d", opts.Facility)
+	}
+	if opts.AppName == "" {
+		opts.AppName = filepath.Base(os.Args[0])
+	}
+	if opts.Hostname == "" {
+		opts.Hostname, _ = os.Hostname()
+	}
+	s := &Syslog{opts: opts}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Syslog) connect() (err error) {
+	if s.opts.Network != "" {
+		s.conn, err = net.Dial(s.opts.Network, s.opts.Address)
+		return
+	}
+	for _, address := range localSyslogAddresses {
+		for _, network := range []string{"unixgram", "unix"} {
+			if s.conn, err = net.Dial(network, address); err == nil {
+				s.opts.Network, s.opts.Address = network, address
+				return nil
+			}
+		}
+	}
+	return errors.New("no local syslog daemon")
+}
+
+func (s *Syslog) Handle(event fswatcher.Event) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return errors.New("syslog closed")
+	}
+	message := s.format(event)
+	var err error
+	if s.conn != nil {
+		_, err = s.conn.Write(message)
+	}
+	// the daemon may have restarted
+	if s.conn == nil || (err != nil && s.opts.Network != "udp") {
+		if s.conn != nil {
+			s.conn.Close()
+		}
+		if err = s.connect(); err == nil {
+			_, err = s.conn.Write(message)
+		}
+	}
+	return errors.Wrap(err, "syslog")
+}
+
+func (s *Syslog) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+func (s *Syslog) format(event fswatcher.Event) []byte {
+	severity := severityNotice
+	if event.Op&fswatcher.Overflow != 0 {
+		severity = severityWarning
+	}
+	t := event.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %d %s [fswatcher@32473",
+		s.opts.Facility*8+severity, t.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		header(s.opts.Hostname, 255), header(s.opts.AppName, 48), os.Getpid(), header(event.Op.String(), 32))
+	param(&b, "op", event.Op.String())
+	param(&b, "path", event.Path)
+	if event.OldPath != "" {
+		param(&b, "old_path", event.OldPath)
+	}
+	b.WriteString("] ")
+	b.WriteString(event.String())
+	if s.opts.Network == "unix" {
+		// stream sockets need a delimiter
+		b.WriteByte('\n')
+	}
+	return []byte(b.String())
+}
+
+// A header field: printable ASCII without spaces, "-" when empty
+func header(value string, max int) string {
+	field := strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, value)
+	if len(field) > max {
+		field = field[:max]
+	}
+	if field == "" {
+		return "-"
+	}
+	return field
+}
+
+func param(b *strings.Builder, name, value string) {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+	fmt.Fprintf(b, ` %s="%s"`, name, value)
+}
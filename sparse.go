@@ -0,0 +1,143 @@
+package fswatcher
+
+import (
+	"strings"
+)
+
+// The folders worth watching for a set of patterns, see WithSparseWatch
+type sparseSet struct {
+	globs []*glob
+	// the folder part of each alternative of the patterns, split in path elements
+	folders [][]segment
+}
+
+// A path element of a pattern
+type segment struct {
+	// "**": any number of elements
+	any  bool
+	glob *glob
+}
+
+func newSparseSet(patterns []string) (*sparseSet, error) {
+	s := &sparseSet{}
+	for _, pattern := range patterns {
+		g, err := compileGlob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		s.globs = append(s.globs, g)
+
+		for _, alternative := range expandBraces(pattern) {
+			elements := strings.Split(alternative, "/")
+			var segments []segment
+			for _, element := range elements {
+				if strings.Contains(element, "**") {
+					segments = append(segments, segment{any: true})
+					continue
+				}
+				g, err := compileGlob(element)
+				if err != nil {
+					return nil, err
+				}
+				segments = append(segments, segment{glob: g})
+			}
+			// a trailing ** matches folders as well
+			if !segments[len(segments)-1].any {
+				segments = segments[:len(segments)-1]
+			}
+			s.folders = append(s.folders, segments)
+		}
+	}
+	return s, nil
+}
+
+// Whether the path (relative, with forward slashes) matches one of the patterns
+func (s *sparseSet) match(rel string) bool {
+	for _, g := range s.globs {
+		if g.match(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether the folder rel must be watched: it may contain matching paths, or it may contain
+// such folders later, e.g. "a" and "a/b" for "a/b/c/*.go", and every folder below "a" for
+// "a/**/c/*.go"
+func (s *sparseSet) wants(rel string) bool {
+	var elements []string
+	if rel != "." {
+		elements = strings.Split(rel, "/")
+	}
+	for _, folder := range s.folders {
+		if matchSegments(folder, elements) || leadsTo(folder, elements) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(segments []segment, elements []string) bool {
+	if len(segments) == 0 {
+		return len(elements) == 0
+	}
+	if segments[0].any {
+		return matchSegments(segments[1:], elements) ||
+			(len(elements) > 0 && matchSegments(segments, elements[1:]))
+	}
+	return len(elements) > 0 && segments[0].glob.match(elements[0]) && matchSegments(segments[1:], elements[1:])
+}
+
+// Whether the elements match the beginning of the segments, a ** matching any elements left
+func leadsTo(segments []segment, elements []string) bool {
+	switch {
+	case len(elements) == 0:
+		return true
+	case len(segments) == 0:
+		return false
+	case segments[0].any:
+		return true
+	}
+	return segments[0].glob.match(elements[0]) && leadsTo(segments[1:], elements[1:])
+}
+
+// The alternatives of the braces of pattern, e.g. "a/b" and "a/c/d" for "a/{b,c/d}"
+func expandBraces(pattern string) []string {
+	start, depth := -1, 0
+	var commas []int
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '[':
+			if end := strings.IndexByte(pattern[i+1:], ']'); end >= 0 {
+				i += end + 1
+			}
+		case '{':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case ',':
+			if depth == 1 {
+				commas = append(commas, i)
+			}
+		case '}':
+			if depth == 0 {
+				continue
+			}
+			depth--
+			if depth > 0 {
+				continue
+			}
+			var expanded []string
+			from := start + 1
+			for _, to := range append(commas, i) {
+				expanded = append(expanded, expandBraces(pattern[:start]+pattern[from:to]+pattern[i+1:])...)
+				from = to + 1
+			}
+			return expanded
+		}
+	}
+	return []string{pattern}
+}
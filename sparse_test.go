@@ -0,0 +1,66 @@
+package fswatcher
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandBraces(t *testing.T) {
+	cases := map[string][]string{
+		"a/*.go":           {"a/*.go"},
+		"a/{b,c/d}/*.go":   {"a/b/*.go", "a/c/d/*.go"},
+		"{a,b{c,d}}/x":     {"a/x", "bc/x", "bd/x"},
+		`\{a,b}/[{]/{x,y}`: {`\{a,b}/[{]/x`, `\{a,b}/[{]/y`},
+	}
+	for pattern, expected := range cases {
+		if expanded := expandBraces(pattern); !reflect.DeepEqual(expanded, expected) {
+			t.Errorf("%s: expected %q, got %q", pattern, expected, expanded)
+		}
+	}
+}
+
+func TestSparseSet(t *testing.T) {
+	s, err := newSparseSet([]string{"services/*/migrations/*.sql", "lib/**/fixtures/*.json", "docs/**", "{web,api}/v[0-9]/*.proto"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wanted := map[string]bool{
+		".":                         true,
+		"services":                  true,
+		"services/a":                true,
+		"services/a/migrations":     true,
+		"services/a/src":            false,
+		"services/a/migrations/old": false,
+		"lib":                       true,
+		"lib/a/b":                   true,
+		"lib/a/b/fixtures":          true,
+		"fixtures":                  false,
+		"docs":                      true,
+		"docs/a/b":                  true,
+		"web":                       true,
+		"api/v2":                    true,
+		"api/v2/x":                  false,
+		"other":                     false,
+	}
+	for rel, expected := range wanted {
+		if s.wants(rel) != expected {
+			t.Errorf("%s: expected wanted %v", rel, expected)
+		}
+	}
+	if !s.match("services/a/migrations/1.sql") || !s.match("docs/a/b/c.md") || s.match("services/a/1.sql") {
+		t.Error("unexpected matches")
+	}
+
+	// the folders below a leading ** may contain matching folders later
+	s, err = newSparseSet([]string{"**/migrations/*.sql"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.wants(".") || !s.wants("svc/new") || !s.wants("svc/new/migrations") {
+		t.Error("expected every folder to be wanted")
+	}
+
+	if _, err := newSparseSet([]string{"a/{b"}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
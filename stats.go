@@ -0,0 +1,148 @@
+package fswatcher
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"time"
+)
+
+// A snapshot of the metrics of a DeepWatch
+type Stats struct {
+	// Number of directories currently watched (the file itself when the target is a file)
+	WatchedDirs int64
+	// Events received from the backend, by operation (create, write, remove, rename, chmod,
+	// and close_write, attrib, overflow with the native backend)
+	Events map[string]uint64
+	// Events received but not delivered to any callback, including those filtered out by
+	// WithIgnoreHidden, WithSparseWatch or Filter
+	Dropped uint64
+	// Events merged into another delivered event
+	Coalesced uint64
+	// Errors reported by the backend or raised while adding watches
+	BackendErrors uint64
+	// Errors returned by the handler
+	HandlerErrors uint64
+	// Time spent in callbacks, in seconds
+	CallbackLatency HistogramSnapshot
+}
+
+// op and extra are the operations of a backendEvent
+var eventOps = []struct {
+	op    fsnotify.Op
+	extra Op
+	name  string
+}{
+	{fsnotify.Create, 0, "create"},
+	{fsnotify.Write, 0, "write"},
+	{fsnotify.Remove, 0, "remove"},
+	{fsnotify.Rename, 0, "rename"},
+	{fsnotify.Chmod, 0, "chmod"},
+	{0, CloseWrite, "close_write"},
+	{0, Attrib, "attrib"},
+	{0, Overflow, "overflow"},
+}
+
+// Metrics shared by all watchers of a DeepWatch. All methods accept a nil receiver,
+// so a Watcher used on its own records nothing.
+type watchMetrics struct {
+	watchedDirs   *Gauge
+	events        map[string]*Counter
+	dropped       *Counter
+	coalesced     *Counter
+	backendErrors *Counter
+	handlerErrors *Counter
+	latency       *Histogram
+}
+
+func newWatchMetrics(registry *Registry, root string) *watchMetrics {
+	labels := Labels{"root": root}
+	m := &watchMetrics{
+		watchedDirs: registry.Gauge("fswatcher_watched_dirs",
+			"Number of directories currently watched.", labels),
+		events: make(map[string]*Counter),
+		dropped: registry.Counter("fswatcher_events_dropped_total",
+			"Events received but not delivered to any callback, or filtered out.", labels),
+		coalesced: registry.Counter("fswatcher_events_coalesced_total",
+			"Events merged into another delivered event.", labels),
+		backendErrors: registry.Counter("fswatcher_backend_errors_total",
+			"Errors reported by the notification backend.", labels),
+		handlerErrors: registry.Counter("fswatcher_handler_errors_total",
+			"Errors returned by the event handler.", labels),
+		latency: registry.Histogram("fswatcher_callback_duration_seconds",
+			"Time spent in callbacks.", labels, DefaultBuckets),
+	}
+	for _, item := range eventOps {
+		m.events[item.name] = registry.Counter("fswatcher_events_total",
+			"Events received from the notification backend.", Labels{"root": root, "op": item.name})
+	}
+	return m
+}
+
+func (m *watchMetrics) watchAdded() {
+	if m != nil {
+		m.watchedDirs.Inc()
+	}
+}
+
+func (m *watchMetrics) watchRemoved() {
+	if m != nil {
+		m.watchedDirs.Dec()
+	}
+}
+
+func (m *watchMetrics) received(event backendEvent) {
+	if m == nil {
+		return
+	}
+	for _, item := range eventOps {
+		if (item.op != 0 && event.Op&item.op == item.op) || (item.extra != 0 && event.extra&item.extra == item.extra) {
+			m.events[item.name].Inc()
+		}
+	}
+}
+
+func (m *watchMetrics) drop() {
+	if m != nil {
+		m.dropped.Inc()
+	}
+}
+
+func (m *watchMetrics) coalesce() {
+	if m != nil {
+		m.coalesced.Inc()
+	}
+}
+
+func (m *watchMetrics) backendError() {
+	if m != nil {
+		m.backendErrors.Inc()
+	}
+}
+
+func (m *watchMetrics) handlerError() {
+	if m != nil {
+		m.handlerErrors.Inc()
+	}
+}
+
+func (m *watchMetrics) observeSince(start time.Time) {
+	if m != nil {
+		m.latency.Observe(time.Since(start).Seconds())
+	}
+}
+
+func (m *watchMetrics) snapshot() Stats {
+	stats := Stats{Events: make(map[string]uint64)}
+	if m == nil {
+		return stats
+	}
+	stats.WatchedDirs = m.watchedDirs.Value()
+	for _, item := range eventOps {
+		stats.Events[item.name] = m.events[item.name].Value()
+	}
+	stats.Dropped = m.dropped.Value()
+	stats.Coalesced = m.coalesced.Value()
+	stats.BackendErrors = m.backendErrors.Value()
+	stats.HandlerErrors = m.handlerErrors.Value()
+	stats.CallbackLatency = m.latency.Snapshot()
+	return stats
+}
@@ -0,0 +1,337 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/raomuyang/fswatcher"
+)
+
+// Option configures a Subscription
+type Option func(opts *options)
+
+type options struct {
+	prefixes   []string
+	since      uint64
+	resume     bool
+	root       string
+	client     *http.Client
+	logger     fswatcher.Logger
+	retryDelay time.Duration
+	longPoll   bool
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		client:     http.DefaultClient,
+		logger:     fswatcher.NopLogger,
+		retryDelay: time.Second,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Only receive the events at or below these paths, relative to the root of the server
+func WithPrefix(prefixes ...string) Option {
+	return func(opts *options) {
+		opts.prefixes = append(opts.prefixes, prefixes...)
+	}
+}
+
+// Receive the events after the sequence number seq, e.g. Subscription.Last of a previous
+// subscription, instead of only the events to come
+func WithSince(seq uint64) Option {
+	return func(opts *options) {
+		opts.since = seq
+		opts.resume = true
+	}
+}
+
+// Join the paths of the events to root, by default they are relative to the root of the server
+func WithRoot(root string) Option {
+	return func(opts *options) {
+		opts.root = root
+	}
+}
+
+func WithHTTPClient(client *http.Client) Option {
+	return func(opts *options) {
+		opts.client = client
+	}
+}
+
+func WithLogger(logger fswatcher.Logger) Option {
+	return func(opts *options) {
+		if logger == nil {
+			logger = fswatcher.NopLogger
+		}
+		opts.logger = logger
+	}
+}
+
+// How long to wait before connecting again after the stream broke, 1s by default
+func WithRetryDelay(delay time.Duration) Option {
+	return func(opts *options) {
+		opts.retryDelay = delay
+	}
+}
+
+// Receive the events with JSON long polls instead of Server-Sent Events, e.g. through proxies
+// which buffer the responses
+func WithLongPoll() Option {
+	return func(opts *options) {
+		opts.longPoll = true
+	}
+}
+
+// The events of a remote Server, received in the background until Stop, as Server-Sent
+// Events or with long polls (WithLongPoll).
+// The subscription resumes after the last received event when the connection breaks;
+// when events were lost meanwhile an Overflow event is delivered for the root.
+type Subscription struct {
+	url     string
+	handler fswatcher.Handler
+	opts    options
+
+	mutex   sync.Mutex
+	last    uint64
+	resume  bool
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+// Subscribe to the server at rawURL, delivering its events to callable
+func Watch(rawURL string, callable fswatcher.Callable, opts ...Option) (*Subscription, error) {
+	return Handle(rawURL, fswatcher.CallableHandler(callable), opts...)
+}
+
+// Subscribe to the server at rawURL, delivering its events to handler
+func Handle(rawURL string, handler fswatcher.Handler, opts ...Option) (*Subscription, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.Errorf("unsupported scheme: %s", rawURL)
+	}
+
+	o := newOptions(opts)
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := &Subscription{
+		url:     rawURL,
+		handler: handler,
+		opts:    o,
+		last:    o.since,
+		resume:  o.resume,
+		cancel:  cancel,
+		stopped: make(chan struct{}),
+	}
+	go sub.run(ctx)
+	return sub, nil
+}
+
+// Stop receiving events, it does not wait, see Stopped
+func (sub *Subscription) Stop() {
+	sub.cancel()
+}
+
+// Stopped returns a channel closed when the subscription has stopped
+func (sub *Subscription) Stopped() <-chan struct{} {
+	return sub.stopped
+}
+
+// The sequence number of the last event received, to resume from with WithSince
+func (sub *Subscription) Last() uint64 {
+	sub.mutex.Lock()
+	defer sub.mutex.Unlock()
+	return sub.last
+}
+
+func (sub *Subscription) run(ctx context.Context) {
+	defer close(sub.stopped)
+	for {
+		var err error
+		if sub.opts.longPoll {
+			err = sub.poll(ctx)
+		} else {
+			err = sub.receive(ctx)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		sub.opts.logger.Warnf("Event stream %s interrupted: %s", sub.url, err)
+		select {
+		case <-time.After(sub.opts.retryDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Read the stream until it breaks
+func (sub *Subscription) receive(ctx context.Context) error {
+	req, err := http.NewRequest(http.MethodGet, sub.requestURL(), nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := sub.opts.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected status: %s", resp.Status)
+	}
+	sub.opts.logger.Infof("Event stream connected: %s", sub.url)
+
+	var id, kind, data string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if seq, err := strconv.ParseUint(id, 10, 64); err == nil {
+				sub.advance(seq)
+			}
+			sub.dispatch(kind, data)
+			id, kind, data = "", "", ""
+		case strings.HasPrefix(line, ":"):
+			// comment, keep-alive
+		case strings.HasPrefix(line, "id:"):
+			id = strings.TrimSpace(strings.TrimPrefix(line, "id:"))
+		case strings.HasPrefix(line, "event:"):
+			kind = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data != "" {
+				data += "\n"
+			}
+			data += strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("stream closed by the server")
+}
+
+// Poll the events until a poll fails
+func (sub *Subscription) poll(ctx context.Context) error {
+	for {
+		req, err := http.NewRequest(http.MethodGet, sub.requestURL(), nil)
+		if err != nil {
+			return err
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := sub.opts.client.Do(req)
+		if err != nil {
+			return err
+		}
+		var response PollResponse
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return errors.Errorf("unexpected status: %s", resp.Status)
+		}
+		if err != nil {
+			return errors.Wrap(err, "invalid poll response")
+		}
+
+		if response.Reset {
+			sub.lost()
+		}
+		for _, message := range response.Events {
+			sub.advance(message.Seq)
+			sub.deliver(message)
+		}
+		sub.advance(response.Last)
+	}
+}
+
+func (sub *Subscription) requestURL() string {
+	u, _ := url.Parse(sub.url)
+	query := u.Query()
+	for _, prefix := range sub.opts.prefixes {
+		query.Add("prefix", prefix)
+	}
+	sub.mutex.Lock()
+	if sub.resume {
+		query.Set("since", strconv.FormatUint(sub.last, 10))
+	}
+	sub.mutex.Unlock()
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func (sub *Subscription) dispatch(kind, data string) {
+	if data == "" {
+		return
+	}
+	switch kind {
+	case "reset":
+		var reset struct {
+			Last uint64 `json:"last"`
+		}
+		json.Unmarshal([]byte(data), &reset)
+		sub.advance(reset.Last)
+		sub.lost()
+	case "", "message":
+		var message Message
+		if err := json.Unmarshal([]byte(data), &message); err != nil {
+			sub.opts.logger.Warnf("Invalid event from %s: %s", sub.url, err)
+			return
+		}
+		sub.deliver(message)
+	}
+}
+
+// Deliver an Overflow event for the root: events were dropped by the server
+func (sub *Subscription) lost() {
+	sub.opts.logger.Warnf("Events of %s lost", sub.url)
+	sub.handle(fswatcher.Event{Op: fswatcher.Overflow, Path: sub.join("."), Time: time.Now()})
+}
+
+func (sub *Subscription) deliver(message Message) {
+	event := message.Event
+	event.Path = sub.join(event.Path)
+	if event.OldPath != "" {
+		event.OldPath = sub.join(event.OldPath)
+	}
+	sub.handle(event)
+}
+
+func (sub *Subscription) handle(event fswatcher.Event) {
+	if err := sub.handler.Handle(event); err != nil && err != fswatcher.ErrUnhandled {
+		sub.opts.logger.Warnf("Handle %s failed: %s", event, err)
+	}
+}
+
+func (sub *Subscription) advance(seq uint64) {
+	sub.mutex.Lock()
+	defer sub.mutex.Unlock()
+	sub.last = seq
+	sub.resume = true
+}
+
+func (sub *Subscription) join(p string) string {
+	if sub.opts.root == "" {
+		return p
+	}
+	return path.Join(sub.opts.root, p)
+}
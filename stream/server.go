@@ -0,0 +1,299 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/raomuyang/fswatcher"
+)
+
+// An event with its sequence number. Paths are relative to the root of the server,
+// with forward slashes.
+type Message struct {
+	Seq uint64 `json:"seq"`
+	fswatcher.Event
+}
+
+// The response of a long poll
+type PollResponse struct {
+	Events []Message `json:"events"`
+	// The sequence number to poll from next time
+	Last uint64 `json:"last"`
+	// Events after the requested sequence number were dropped from the buffer
+	Reset bool `json:"reset,omitempty"`
+}
+
+const (
+	DefaultCapacity    = 1024
+	defaultPollTimeout = 30 * time.Second
+	maxPollTimeout     = 5 * time.Minute
+	keepAlive          = 15 * time.Second
+)
+
+// Server keeps the latest events of a DeepWatch and serves them over HTTP, it is the
+// fswatcher.Handler of the watch.
+//
+// A request with "Accept: text/event-stream" receives the events as Server-Sent Events,
+// any other request is a JSON long poll answered with a PollResponse. Both accept:
+//
+//	prefix   only the events at or below this path, relative to the root (repeatable)
+//	since    the events after this sequence number (or the Last-Event-ID header),
+//	         by default only the events to come
+//	timeout  how long a long poll waits for events, e.g. "10s" (30s by default)
+type Server struct {
+	root     string
+	capacity int
+
+	mutex   sync.Mutex
+	buffer  []Message // a ring once full, buffer[oldest] is the oldest message
+	oldest  int
+	last    uint64
+	changed chan struct{}
+	done    chan struct{}
+	closed  bool
+}
+
+// A server for the events of the watch of root, keeping the latest capacity events
+// (DefaultCapacity if capacity <= 0)
+func NewServer(root string, capacity int) *Server {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &Server{
+		root:     filepath.Clean(root),
+		capacity: capacity,
+		changed:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Publish event
+func (server *Server) Handle(event fswatcher.Event) error {
+	event.Path = server.rel(event.Path)
+	if event.OldPath != "" {
+		event.OldPath = server.rel(event.OldPath)
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.last++
+	message := Message{Seq: server.last, Event: event}
+	if len(server.buffer) < server.capacity {
+		server.buffer = append(server.buffer, message)
+	} else {
+		server.buffer[server.oldest] = message
+		server.oldest = (server.oldest + 1) % server.capacity
+	}
+	close(server.changed)
+	server.changed = make(chan struct{})
+	return nil
+}
+
+// The sequence number of the latest event
+func (server *Server) Last() uint64 {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.last
+}
+
+// End the pending requests, e.g. before shutting the http.Server down
+func (server *Server) Close() {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if !server.closed {
+		server.closed = true
+		close(server.done)
+	}
+}
+
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	since, ok, err := parseSince(query.Get("since"), r.Header.Get("Last-Event-ID"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !ok {
+		since = server.Last()
+	}
+	filter := newPrefixFilter(query["prefix"])
+
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		server.serveEvents(w, r, since, filter)
+		return
+	}
+
+	timeout := defaultPollTimeout
+	if s := query.Get("timeout"); s != "" {
+		timeout, err = time.ParseDuration(s)
+		if err != nil || timeout < 0 {
+			http.Error(w, "invalid timeout: "+s, http.StatusBadRequest)
+			return
+		}
+		if timeout > maxPollTimeout {
+			timeout = maxPollTimeout
+		}
+	}
+	server.poll(w, r, since, filter, timeout)
+}
+
+func parseSince(query, lastEventID string) (since uint64, ok bool, err error) {
+	s := query
+	if s == "" {
+		s = lastEventID
+	}
+	if s == "" {
+		return 0, false, nil
+	}
+	since, err = strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid sequence number: %s", s)
+	}
+	return since, true, nil
+}
+
+// The messages after since accepted by filter, the sequence number to continue from,
+// whether messages after since were dropped, and a channel closed on the next event
+func (server *Server) after(since uint64, filter prefixFilter) (messages []Message, last uint64, reset bool, changed <-chan struct{}) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	last = server.last
+	if since > last {
+		// the server restarted, its sequence numbers are new
+		since = 0
+		reset = true
+	}
+	if len(server.buffer) > 0 && since+1 < server.buffer[server.oldest].Seq {
+		reset = true
+	}
+	for i := range server.buffer {
+		message := server.buffer[(server.oldest+i)%len(server.buffer)]
+		if message.Seq > since && filter.accept(message.Event) {
+			messages = append(messages, message)
+		}
+	}
+	return messages, last, reset, server.changed
+}
+
+func (server *Server) poll(w http.ResponseWriter, r *http.Request, since uint64, filter prefixFilter, timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	response := PollResponse{Events: []Message{}, Last: since}
+	for {
+		messages, last, reset, changed := server.after(since, filter)
+		response.Last = last
+		response.Reset = response.Reset || reset
+		if len(messages) > 0 || reset {
+			response.Events = append(response.Events, messages...)
+			break
+		}
+		// nothing accepted yet, wait from the latest event
+		since = last
+		select {
+		case <-changed:
+			continue
+		case <-timer.C:
+		case <-r.Context().Done():
+		case <-server.done:
+		}
+		break
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (server *Server) serveEvents(w http.ResponseWriter, r *http.Request, since uint64, filter prefixFilter) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	// the position of the stream, to resume from if the connection breaks before any event
+	fmt.Fprintf(w, "id: %d\n\n", since)
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		messages, last, reset, changed := server.after(since, filter)
+		if reset {
+			fmt.Fprintf(w, "event: reset\ndata: {\"last\":%d}\n\n", last)
+		}
+		for _, message := range messages {
+			data, err := json.Marshal(message)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\ndata: %s\n\n", message.Seq, data)
+		}
+		since = last
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-server.done:
+			return
+		}
+	}
+}
+
+func (server *Server) rel(path string) string {
+	rel, err := filepath.Rel(server.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Accepts the events at or below one of the prefixes, every event when there is none
+type prefixFilter []string
+
+func newPrefixFilter(prefixes []string) prefixFilter {
+	var filter prefixFilter
+	for _, prefix := range prefixes {
+		prefix = strings.Trim(prefix, "/")
+		if prefix == "" || prefix == "." {
+			return nil
+		}
+		filter = append(filter, prefix)
+	}
+	return filter
+}
+
+func (filter prefixFilter) accept(event fswatcher.Event) bool {
+	if len(filter) == 0 || event.Op == fswatcher.Overflow {
+		return true
+	}
+	for _, prefix := range filter {
+		if under(event.Path, prefix) || (event.OldPath != "" && under(event.OldPath, prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+func under(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
@@ -0,0 +1,166 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raomuyang/fswatcher"
+	"github.com/raomuyang/fswatcher/fswatchertest"
+)
+
+const timeout = 3 * time.Second
+
+func publish(server *Server, op fswatcher.Op, paths ...string) {
+	for _, path := range paths {
+		server.Handle(fswatcher.Event{Op: op, Path: path, Time: time.Now()})
+	}
+}
+
+func TestSubscription(t *testing.T) {
+	testSubscription(t)
+}
+
+func TestSubscription_LongPoll(t *testing.T) {
+	testSubscription(t, WithLongPoll())
+}
+
+func testSubscription(t *testing.T, opts ...Option) {
+	server := NewServer("/data", 0)
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	defer server.Close()
+
+	recorder := fswatchertest.NewRecorder("/mnt")
+	sub, err := Handle(httpServer.URL, recorder, append(opts,
+		WithSince(0), WithPrefix("a"), WithRoot("/mnt"), WithRetryDelay(10*time.Millisecond))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Stop()
+
+	publish(server, fswatcher.Create, "/data/a/x", "/data/b/y", "/data/a")
+	recorder.ExpectEvents(t, timeout, fswatchertest.Exactly,
+		fswatchertest.Create("a/x"), fswatchertest.Create("a"))
+	server.Handle(fswatcher.Event{Op: fswatcher.Create, Path: "/data/a/z", OldPath: "/data/b/z"})
+	recorder.ExpectEvents(t, timeout, fswatchertest.Moved("b/z", "a/z"))
+
+	// the subscription resumes after the last event it received
+	httpServer.CloseClientConnections()
+	publish(server, fswatcher.Write, "/data/a/x")
+	recorder.ExpectEvents(t, timeout, fswatchertest.Exactly, fswatchertest.Write("a/x"))
+	if last := sub.Last(); last != server.Last() {
+		t.Errorf("expected last %d, got %d", server.Last(), last)
+	}
+
+	sub.Stop()
+	select {
+	case <-sub.Stopped():
+	case <-time.After(timeout):
+		t.Fatal("timeout waiting for the subscription to stop")
+	}
+}
+
+func TestSubscription_Reset(t *testing.T) {
+	testSubscriptionReset(t)
+}
+
+func TestSubscription_ResetLongPoll(t *testing.T) {
+	testSubscriptionReset(t, WithLongPoll())
+}
+
+func testSubscriptionReset(t *testing.T, opts ...Option) {
+	server := NewServer("/data", 2)
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	defer server.Close()
+
+	publish(server, fswatcher.Create, "/data/1", "/data/2", "/data/3", "/data/4")
+	recorder := fswatchertest.NewRecorder("/data")
+	sub, err := Watch(httpServer.URL, recorder.Callable(), append(opts, WithSince(1), WithRoot("/data"))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Stop()
+
+	// the Overflow event is not handled by the callable
+	recorder.ExpectEvents(t, timeout, fswatchertest.Exactly, fswatchertest.Create("3"), fswatchertest.Create("4"))
+}
+
+func TestSubscription_MultilineData(t *testing.T) {
+	data, _ := json.MarshalIndent(Message{Seq: 1, Event: fswatcher.Event{Op: fswatcher.Create, Path: "a"}}, "", "  ")
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "id: 1\ndata: %s\n\n", strings.Replace(string(data), "\n", "\ndata: ", -1))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer httpServer.Close()
+
+	recorder := fswatchertest.NewRecorder("/data")
+	sub, err := Handle(httpServer.URL, recorder, WithRoot("/data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Stop()
+	recorder.ExpectEvents(t, timeout, fswatchertest.Exactly, fswatchertest.Create("a"))
+}
+
+func poll(t *testing.T, url string) PollResponse {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var response PollResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestPoll(t *testing.T) {
+	server := NewServer("/data", 2)
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	defer server.Close()
+
+	response := poll(t, httpServer.URL+"?timeout=10ms")
+	if len(response.Events) != 0 || response.Last != 0 {
+		t.Errorf("expected no events, got %+v", response)
+	}
+
+	publish(server, fswatcher.Create, "/data/a", "/data/b/c")
+	response = poll(t, httpServer.URL+"?since=0&prefix=b")
+	if len(response.Events) != 1 || response.Events[0].Path != "b/c" || response.Events[0].Seq != 2 || response.Reset {
+		t.Errorf("expected b/c, got %+v", response)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		publish(server, fswatcher.Write, "/data/a")
+	}()
+	response = poll(t, httpServer.URL+"?since=2")
+	if len(response.Events) != 1 || response.Events[0].Op != fswatcher.Write || response.Last != 3 {
+		t.Errorf("expected WRITE a, got %+v", response)
+	}
+
+	response = poll(t, httpServer.URL+"?since=0")
+	if !response.Reset || len(response.Events) != 2 || response.Events[0].Seq != 2 || response.Events[1].Seq != 3 {
+		t.Errorf("expected a reset and the 2 buffered events, got %+v", response)
+	}
+
+	resp, err := http.Get(httpServer.URL + "?since=x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected bad request, got %s", resp.Status)
+	}
+}
@@ -0,0 +1,244 @@
+package fswatcher
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+// Options of Tail
+type TailOptions struct {
+	// Called with the data appended to the file, or once per line when Lines is set. It is
+	// called without holding the Tailer, so it may call Offset or Stop.
+	OnAppend func(path string, data []byte)
+	// Deliver complete lines (including the trailing newline) instead of raw chunks.
+	// An incomplete last line is delivered when the file is rotated or removed.
+	Lines bool
+	// Deliver the existing content first instead of starting at the end of the file
+	FromStart bool
+	// Options of the underlying watcher, e.g. WithLogger
+	Options []Option
+}
+
+// Follows the data appended to a file, like `tail -F`
+type Tailer struct {
+	path    string
+	opts    TailOptions
+	watcher *Watcher
+
+	// Held while reading and calling OnAppend, so that the data is delivered in order
+	delivery sync.Mutex
+	mutex    sync.Mutex
+	file     *os.File
+	offset   int64
+	partial  []byte
+	// Read but not delivered yet
+	chunks [][]byte
+}
+
+const tailBufferSize = 32 * 1024
+
+// Start delivering the data appended to the file at path. The file is followed by name:
+// when it is truncated the reading restarts at its beginning, when it is rotated the rest
+// of the old file is delivered, then the new file from its beginning.
+func Tail(path string, opts TailOptions) (*Tailer, error) {
+	tailer := &Tailer{path: path, opts: opts}
+	tailer.watcher = &Watcher{
+		Path: path,
+		Callable: Callable{
+			OnCreate:   tailer.onCreate,
+			OnRecreate: tailer.onCreate,
+			OnWrite:    tailer.onWrite,
+			OnRename:   tailer.onGone,
+			OnRemove:   tailer.onGone,
+		},
+	}
+
+	tailer.mutex.Lock()
+	err := tailer.open(!opts.FromStart)
+	tailer.mutex.Unlock()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	err = tailer.watcher.Watch(append(append([]Option(nil), opts.Options...), WithFollow())...)
+	if err != nil {
+		tailer.close()
+		return nil, err
+	}
+	if opts.FromStart {
+		tailer.onWrite(path)
+	}
+	return tailer, nil
+}
+
+// Stop following the file
+func (tailer *Tailer) Stop() {
+	tailer.watcher.Stop()
+	go func() {
+		<-tailer.watcher.Stopped()
+		tailer.close()
+	}()
+}
+
+// Stopped returns a channel closed when the tailer has stopped
+func (tailer *Tailer) Stopped() <-chan struct{} {
+	return tailer.watcher.Stopped()
+}
+
+// The offset of the next byte to read in the current file
+func (tailer *Tailer) Offset() int64 {
+	tailer.mutex.Lock()
+	defer tailer.mutex.Unlock()
+	return tailer.offset
+}
+
+// Open the file at path, at its end when atEnd is set
+func (tailer *Tailer) open(atEnd bool) error {
+	f, err := os.Open(tailer.path)
+	if err != nil {
+		return err
+	}
+	tailer.file = f
+	tailer.offset = 0
+	tailer.partial = nil
+	if atEnd {
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		tailer.offset = info.Size()
+	}
+	return nil
+}
+
+func (tailer *Tailer) close() {
+	tailer.mutex.Lock()
+	defer tailer.mutex.Unlock()
+	if tailer.file != nil {
+		tailer.file.Close()
+		tailer.file = nil
+	}
+}
+
+func (tailer *Tailer) onCreate(filePath string) {
+	var err error
+	tailer.update(func() {
+		if tailer.file != nil {
+			// replaced without being removed first: finish the old file
+			tailer.read()
+			tailer.flush()
+			tailer.file.Close()
+			tailer.file = nil
+		}
+		if err = tailer.open(false); err == nil {
+			tailer.read()
+		}
+	})
+	if err != nil {
+		tailer.watcher.logger.Warnf("Tail: open %s failed: %s", filePath, err)
+	}
+}
+
+func (tailer *Tailer) onWrite(filePath string) {
+	tailer.update(func() {
+		if tailer.file == nil {
+			if err := tailer.open(false); err != nil {
+				return
+			}
+		}
+		tailer.read()
+	})
+}
+
+// The file was rotated or removed: the data written to it until now is still readable
+func (tailer *Tailer) onGone(filePath string) {
+	tailer.update(func() {
+		if tailer.file == nil {
+			return
+		}
+		tailer.read()
+		tailer.flush()
+		tailer.file.Close()
+		tailer.file = nil
+	})
+}
+
+// Call fn with the mutex held, then OnAppend with the data it read once the mutex is released
+func (tailer *Tailer) update(fn func()) {
+	tailer.delivery.Lock()
+	defer tailer.delivery.Unlock()
+
+	tailer.mutex.Lock()
+	fn()
+	chunks := tailer.chunks
+	tailer.chunks = nil
+	tailer.mutex.Unlock()
+
+	for _, chunk := range chunks {
+		tailer.opts.OnAppend(tailer.path, chunk)
+	}
+}
+
+// Collect the data between the offset and the end of the current file
+func (tailer *Tailer) read() {
+	info, err := tailer.file.Stat()
+	if err != nil {
+		return
+	}
+	if info.Size() < tailer.offset {
+		tailer.watcher.logger.Infof("Tail: %s truncated", tailer.path)
+		tailer.offset = 0
+		tailer.partial = nil
+	}
+
+	buf := make([]byte, tailBufferSize)
+	for {
+		n, err := tailer.file.ReadAt(buf, tailer.offset)
+		if n > 0 {
+			tailer.offset += int64(n)
+			tailer.collect(buf[:n])
+		}
+		if err == io.EOF || n == 0 {
+			return
+		}
+		if err != nil {
+			tailer.watcher.logger.Warnf("Tail: read %s failed: %s", tailer.path, err)
+			return
+		}
+	}
+}
+
+// Keep data to deliver, split into lines when Lines is set
+func (tailer *Tailer) collect(data []byte) {
+	if tailer.opts.OnAppend == nil {
+		return
+	}
+	if !tailer.opts.Lines {
+		chunk := make([]byte, len(data))
+		copy(chunk, data)
+		tailer.chunks = append(tailer.chunks, chunk)
+		return
+	}
+
+	tailer.partial = append(tailer.partial, data...)
+	for {
+		i := bytes.IndexByte(tailer.partial, '\n')
+		if i < 0 {
+			return
+		}
+		line := make([]byte, i+1)
+		copy(line, tailer.partial[:i+1])
+		tailer.partial = tailer.partial[i+1:]
+		tailer.chunks = append(tailer.chunks, line)
+	}
+}
+
+// Collect an incomplete last line
+func (tailer *Tailer) flush() {
+	if len(tailer.partial) > 0 && tailer.opts.OnAppend != nil {
+		tailer.chunks = append(tailer.chunks, tailer.partial)
+		tailer.partial = nil
+	}
+}
@@ -0,0 +1,131 @@
+package fswatcher_test
+
+import (
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/raomuyang/fswatcher"
+	"github.com/raomuyang/fswatcher/fswatchertest"
+)
+
+type appended struct {
+	mutex sync.Mutex
+	data  []string
+}
+
+func (a *appended) onAppend(path string, data []byte) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.data = append(a.data, string(data))
+}
+
+func (a *appended) expect(t *testing.T, expected ...string) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		a.mutex.Lock()
+		got := append([]string(nil), a.data...)
+		a.mutex.Unlock()
+		if reflect.DeepEqual(got, expected) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %q, got %q", expected, got)
+		}
+		<-time.After(10 * time.Millisecond)
+	}
+}
+
+func TestTail_Lines(t *testing.T) {
+	tree := fswatchertest.NewTree(t)
+	tree.WriteFile("app.log", "old\n")
+
+	a := &appended{}
+	tailer, err := fswatcher.Tail(tree.Path("app.log"), fswatcher.TailOptions{
+		OnAppend: a.onAppend,
+		Lines:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tailer.Stop()
+
+	tree.AppendFile("app.log", "a\nb")
+	a.expect(t, "a\n")
+	tree.AppendFile("app.log", "c\n")
+	a.expect(t, "a\n", "bc\n")
+
+	// truncation
+	if err := os.Truncate(tree.Path("app.log"), 0); err != nil {
+		t.Fatal(err)
+	}
+	tree.AppendFile("app.log", "d\n")
+	a.expect(t, "a\n", "bc\n", "d\n")
+
+	// rotation: the rest of the old file, then the new one
+	tree.AppendFile("app.log", "e")
+	tree.Rename("app.log", "app.log.1")
+	tree.WriteFile("app.log", "f\n")
+	a.expect(t, "a\n", "bc\n", "d\n", "e", "f\n")
+}
+
+func TestTail_FromStart(t *testing.T) {
+	tree := fswatchertest.NewTree(t)
+	tree.WriteFile("data", "12")
+
+	a := &appended{}
+	tailer, err := fswatcher.Tail(tree.Path("data"), fswatcher.TailOptions{
+		OnAppend:  a.onAppend,
+		FromStart: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tailer.Stop()
+
+	a.expect(t, "12")
+	tree.AppendFile("data", "3")
+	a.expect(t, "12", "3")
+	if offset := tailer.Offset(); offset != 3 {
+		t.Errorf("expected offset 3, got %d", offset)
+	}
+}
+
+func TestTail_CallbackUsesTailer(t *testing.T) {
+	tree := fswatchertest.NewTree(t)
+	tree.WriteFile("data", "")
+
+	offsets := make(chan int64, 10)
+	var tailer *fswatcher.Tailer
+	var ready sync.WaitGroup
+	ready.Add(1)
+	tailer, err := fswatcher.Tail(tree.Path("data"), fswatcher.TailOptions{
+		OnAppend: func(path string, data []byte) {
+			ready.Wait()
+			offsets <- tailer.Offset()
+			tailer.Stop()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ready.Done()
+
+	tree.AppendFile("data", "abc")
+	select {
+	case offset := <-offsets:
+		if offset != 3 {
+			t.Errorf("expected offset 3, got %d", offset)
+		}
+	case <-time.After(timeout):
+		t.Fatal("timeout waiting for the data")
+	}
+	select {
+	case <-tailer.Stopped():
+	case <-time.After(timeout):
+		t.Fatal("timeout waiting for the tailer to stop")
+	}
+}
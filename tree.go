@@ -0,0 +1,368 @@
+package fswatcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A file or folder of a Tree
+type Node struct {
+	Path  string
+	Name  string
+	IsDir bool
+	// Size of the file, or total size of the files below the folder
+	Size int64
+	// 1 for a file, or number of files below the folder
+	Files   int
+	Mode    os.FileMode
+	ModTime time.Time
+}
+
+// An in-memory model of a folder, initialized by a scan and kept in sync by the events
+// of a DeepWatch. A Tree is a Handler: pass it to Handle, or call Handle from your own
+// handler before refreshing a view of it.
+// Paths are the paths of the events, i.e. joined to the root.
+// A folder which cannot be listed is kept empty, see Errors.
+type Tree struct {
+	root string
+	// Whether a path below the root belongs to the tree, nil for every path
+	include func(path string, dir bool) bool
+	mutex   sync.RWMutex
+	top     *treeNode
+	// the paths which could not be scanned
+	failures map[string]*PathError
+}
+
+type treeNode struct {
+	name     string
+	dir      bool
+	size     int64
+	files    int
+	mode     os.FileMode
+	modTime  time.Time
+	parent   *treeNode
+	children map[string]*treeNode
+}
+
+// Scan root into a new Tree
+func NewTree(root string) (*Tree, error) {
+	tree := &Tree{root: filepath.Clean(root)}
+	if err := tree.Rescan(); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// Scan the root again, to catch up with the changes made before the watch started
+func (tree *Tree) Rescan() error {
+	failures := make(map[string]*PathError)
+	top, err := scanNode(tree.root, tree.include, failures)
+	if err != nil {
+		return err
+	}
+	tree.mutex.Lock()
+	defer tree.mutex.Unlock()
+	tree.top = top
+	tree.failures = failures
+	return nil
+}
+
+// The paths of the tree which could not be scanned, nil when the whole tree was scanned.
+// The folders listed are empty in the tree.
+func (tree *Tree) Errors() WatchErrors {
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	return sortErrors(tree.failures)
+}
+
+// Apply an event to the tree
+func (tree *Tree) Handle(event Event) error {
+	path := filepath.Clean(event.Path)
+	switch event.Op {
+	case Create, Write, Recreate, Attrib, Existing:
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			// already gone, a Remove event follows
+			tree.remove(path)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return tree.update(path, info, event.Op == Create || event.Op == Recreate)
+	case Remove, Rename:
+		tree.remove(path)
+	case Overflow:
+		return tree.Rescan()
+	}
+	return nil
+}
+
+// The node at path
+func (tree *Tree) Lookup(path string) (Node, bool) {
+	path = filepath.Clean(path)
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	n := tree.find(path)
+	if n == nil {
+		return Node{}, false
+	}
+	return n.node(path), true
+}
+
+// The nodes of the folder at dir, sorted by name
+func (tree *Tree) Children(dir string) []Node {
+	dir = filepath.Clean(dir)
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	n := tree.find(dir)
+	if n == nil {
+		return nil
+	}
+	var nodes []Node
+	for _, name := range n.names() {
+		nodes = append(nodes, n.children[name].node(filepath.Join(dir, name)))
+	}
+	return nodes
+}
+
+// Call fn for every node, depth first and sorted by name, starting with the root.
+// Returning filepath.SkipDir for a folder skips its content, any other error stops the walk.
+// The tree is locked during the walk: fn must not modify it.
+func (tree *Tree) Walk(fn func(node Node) error) error {
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	if tree.top == nil {
+		return nil
+	}
+	err := tree.top.walk(tree.root, fn)
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// The node at path, nil if it is not in the tree
+func (tree *Tree) find(path string) *treeNode {
+	n := tree.top
+	for _, name := range tree.split(path) {
+		if n == nil || n.children == nil {
+			return nil
+		}
+		n = n.children[name]
+	}
+	return n
+}
+
+// The names from the root to path, nil for the root itself or a path outside of the tree
+func (tree *Tree) split(path string) []string {
+	rel, err := filepath.Rel(tree.root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil
+	}
+	return strings.Split(rel, string(filepath.Separator))
+}
+
+func (tree *Tree) update(path string, info os.FileInfo, rescan bool) error {
+	names := tree.split(path)
+	if len(names) == 0 {
+		if path == tree.root {
+			return tree.Rescan()
+		}
+		return nil
+	}
+	if tree.include != nil && !tree.include(path, info.IsDir()) {
+		return nil
+	}
+
+	tree.mutex.Lock()
+	defer tree.mutex.Unlock()
+	if tree.top == nil {
+		return nil
+	}
+
+	// the first missing folder on the way is scanned with everything below it
+	parent := tree.top
+	for i, name := range names[:len(names)-1] {
+		child := parent.children[name]
+		if child == nil || !child.dir {
+			return tree.replace(parent, filepath.Join(tree.root, filepath.Join(names[:i+1]...)))
+		}
+		parent = child
+	}
+	if !parent.dir {
+		return nil
+	}
+
+	name := names[len(names)-1]
+	existing := parent.children[name]
+	if info.IsDir() {
+		if existing != nil && existing.dir && !rescan {
+			existing.mode = info.Mode()
+			existing.modTime = info.ModTime()
+			return nil
+		}
+		return tree.replace(parent, path)
+	}
+	n := &treeNode{name: name, size: info.Size(), files: 1, mode: info.Mode(), modTime: info.ModTime()}
+	parent.attach(n)
+	return nil
+}
+
+// Scan path and attach it to parent, in place of the current node
+func (tree *Tree) replace(parent *treeNode, path string) error {
+	failures := make(map[string]*PathError)
+	n, err := scanNode(path, tree.include, failures)
+	if os.IsNotExist(err) {
+		parent.detach(filepath.Base(path))
+		tree.forget(path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	parent.attach(n)
+	tree.forget(path)
+	for p, failure := range failures {
+		tree.failures[p] = failure
+	}
+	return nil
+}
+
+// Forget the failures of path and everything below it
+func (tree *Tree) forget(path string) {
+	prefix := path + string(filepath.Separator)
+	for p := range tree.failures {
+		if p == path || strings.HasPrefix(p, prefix) {
+			delete(tree.failures, p)
+		}
+	}
+}
+
+func (tree *Tree) remove(path string) {
+	names := tree.split(path)
+	if len(names) == 0 {
+		return
+	}
+	tree.mutex.Lock()
+	defer tree.mutex.Unlock()
+	if parent := tree.find(filepath.Dir(path)); parent != nil {
+		parent.detach(names[len(names)-1])
+	}
+	tree.forget(path)
+}
+
+// Scan path and everything below it accepted by include (every path if nil), the paths below
+// which cannot be scanned are added to failures
+func scanNode(path string, include func(path string, dir bool) bool, failures map[string]*PathError) (*treeNode, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	n := &treeNode{name: info.Name(), dir: info.IsDir(), mode: info.Mode(), modTime: info.ModTime()}
+	if !n.dir {
+		n.size = info.Size()
+		n.files = 1
+		return n, nil
+	}
+
+	n.children = make(map[string]*treeNode)
+	items, err := ioutil.ReadDir(path)
+	if os.IsNotExist(err) {
+		return nil, err
+	}
+	if err != nil {
+		failures[path] = &PathError{Op: "list", Path: path, Err: err}
+		return n, nil
+	}
+	for _, item := range items {
+		sub := filepath.Join(path, item.Name())
+		if include != nil && !include(sub, item.IsDir()) {
+			continue
+		}
+		child, err := scanNode(sub, include, failures)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			failures[sub] = &PathError{Op: "stat", Path: sub, Err: err}
+			continue
+		}
+		child.parent = n
+		n.children[child.name] = child
+		n.size += child.size
+		n.files += child.files
+	}
+	return n, nil
+}
+
+// Add n to the folder, in place of the node with the same name
+func (parent *treeNode) attach(n *treeNode) {
+	parent.detach(n.name)
+	n.parent = parent
+	parent.children[n.name] = n
+	parent.add(n.size, n.files)
+}
+
+func (parent *treeNode) detach(name string) {
+	n := parent.children[name]
+	if n == nil {
+		return
+	}
+	delete(parent.children, name)
+	n.parent = nil
+	parent.add(-n.size, -n.files)
+}
+
+// Update the totals of the folder and its ancestors
+func (n *treeNode) add(size int64, files int) {
+	for ; n != nil; n = n.parent {
+		n.size += size
+		n.files += files
+	}
+}
+
+func (n *treeNode) names() []string {
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (n *treeNode) node(path string) Node {
+	return Node{
+		Path:    path,
+		Name:    filepath.Base(path),
+		IsDir:   n.dir,
+		Size:    n.size,
+		Files:   n.files,
+		Mode:    n.mode,
+		ModTime: n.modTime,
+	}
+}
+
+func (n *treeNode) walk(path string, fn func(node Node) error) error {
+	if err := fn(n.node(path)); err != nil {
+		return err
+	}
+	for _, name := range n.names() {
+		err := n.children[name].walk(filepath.Join(path, name), fn)
+		if err == filepath.SkipDir {
+			if n.children[name].dir {
+				continue
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package fswatcher_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/raomuyang/fswatcher"
+	"github.com/raomuyang/fswatcher/fswatchertest"
+)
+
+func expectNode(t *testing.T, model *fswatcher.Tree, path string, size int64, files int) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		node, ok := model.Lookup(path)
+		if ok && node.Size == size && node.Files == files {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: expected size %d and %d files, got %+v (found: %v)", path, size, files, node, ok)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTree_Scan(t *testing.T) {
+	tree := fswatchertest.NewTree(t, "a/b/", "c/")
+	tree.WriteFile("a/x", "xx")
+	tree.WriteFile("a/b/y", "yyy")
+	tree.WriteFile("z", "z")
+
+	model, err := fswatcher.NewTree(tree.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectNode(t, model, tree.Root, 6, 3)
+	expectNode(t, model, tree.Path("a"), 5, 2)
+	expectNode(t, model, tree.Path("a/b/y"), 3, 1)
+	if _, ok := model.Lookup(tree.Path("missing")); ok {
+		t.Error("expected no node for a missing path")
+	}
+
+	var names []string
+	for _, node := range model.Children(tree.Root) {
+		names = append(names, node.Name)
+	}
+	if len(names) != 3 || names[0] != "a" || names[1] != "c" || names[2] != "z" {
+		t.Errorf("unexpected children %v", names)
+	}
+
+	var walked []string
+	model.Walk(func(node fswatcher.Node) error {
+		rel, _ := filepath.Rel(tree.Root, node.Path)
+		walked = append(walked, filepath.ToSlash(rel))
+		if node.Name == "b" {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	expected := []string{".", "a", "a/b", "a/x", "c", "z"}
+	if len(walked) != len(expected) {
+		t.Fatalf("expected walk %v, got %v", expected, walked)
+	}
+	for i := range expected {
+		if walked[i] != expected[i] {
+			t.Fatalf("expected walk %v, got %v", expected, walked)
+		}
+	}
+}
+
+func TestTree_Unreadable(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read any folder")
+	}
+	tree := fswatchertest.NewTree(t, "a/b/", "c/")
+	tree.WriteFile("a/b/y", "yyy")
+	tree.WriteFile("c/z", "z")
+	if err := os.Chmod(tree.Path("a/b"), 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(tree.Path("a/b"), 0755)
+
+	model, err := fswatcher.NewTree(tree.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the unreadable folder is empty, the rest of the tree is scanned
+	expectNode(t, model, tree.Path("a/b"), 0, 0)
+	expectNode(t, model, tree.Root, 1, 1)
+	errs := model.Errors()
+	if len(errs) != 1 || errs[0].Op != "list" || errs[0].Path != tree.Path("a/b") || !os.IsPermission(errs[0].Err) {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+
+	os.Chmod(tree.Path("a/b"), 0755)
+	if err := model.Handle(fswatcher.Event{Op: fswatcher.Create, Path: tree.Path("a/b")}); err != nil {
+		t.Fatal(err)
+	}
+	expectNode(t, model, tree.Path("a/b"), 3, 1)
+	if errs := model.Errors(); errs != nil {
+		t.Errorf("unexpected errors after the folder was scanned again: %v", errs)
+	}
+}
+
+func TestTree_Events(t *testing.T) {
+	tree := fswatchertest.NewTree(t, "a/")
+	model, err := fswatcher.NewTree(tree.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dw, err := fswatcher.Handle(tree.Root, model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dw.Stop()
+
+	tree.WriteFile("a/x", "xx")
+	expectNode(t, model, tree.Root, 2, 1)
+	tree.AppendFile("a/x", "xxx")
+	expectNode(t, model, tree.Path("a"), 5, 1)
+
+	tree.Mkdir("b")
+	tree.WriteFile("b/y", "y")
+	expectNode(t, model, tree.Root, 6, 2)
+
+	tree.Rename("a/x", "b/x")
+	expectNode(t, model, tree.Path("a"), 0, 0)
+	expectNode(t, model, tree.Path("b"), 6, 2)
+
+	tree.Remove("b")
+	expectNode(t, model, tree.Root, 0, 0)
+	if _, ok := model.Lookup(tree.Path("b/y")); ok {
+		t.Error("expected b/y to be removed")
+	}
+}
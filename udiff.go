@@ -0,0 +1,199 @@
+package fswatcher
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// An edit of a line diff: ' ' kept, '-' removed, '+' added
+type edit struct {
+	op   byte
+	line string
+}
+
+// Beyond this number of differences, the remaining lines are reported as entirely replaced
+const maxDiffEdits = 1000
+
+// The edit script turning the lines of a into the lines of b
+func diffLines(a, b []string) []edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var edits []edit
+	for _, line := range a[:prefix] {
+		edits = append(edits, edit{' ', line})
+	}
+	edits = append(edits, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		edits = append(edits, edit{' ', line})
+	}
+	return edits
+}
+
+// Myers' O((N+M)D) algorithm, see "An O(ND) Difference Algorithm and Its Variations"
+func myers(a, b []string) []edit {
+	n, m := len(a), len(b)
+	max := n + m
+	// v[k+max+1] is the furthest x reached on the diagonal k
+	v := make([]int, 2*max+3)
+	at := func(k int) *int { return &v[k+max+1] }
+	// trace[d][k+d] is the furthest x reached on the diagonal k after d differences
+	var trace [][]int
+	done := false
+	for d := 0; !done; d++ {
+		if d > maxDiffEdits {
+			return replaced(a, b)
+		}
+		for k := -d; k <= d && !done; k += 2 {
+			var x int
+			if k == -d || (k != d && *at(k - 1) < *at(k + 1)) {
+				x = *at(k + 1)
+			} else {
+				x = *at(k - 1) + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			*at(k) = x
+			done = x >= n && y >= m
+		}
+		snapshot := make([]int, 2*d+1)
+		copy(snapshot, v[max+1-d:max+2+d])
+		trace = append(trace, snapshot)
+	}
+
+	var edits []edit
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := func(k int) int { return trace[d-1][k+d-1] }
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && prev(k-1) < prev(k+1)) {
+			prevK = k + 1
+		}
+		prevX := prev(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			edits = append(edits, edit{' ', a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			edits = append(edits, edit{'+', b[y-1]})
+			y--
+		} else {
+			edits = append(edits, edit{'-', a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		edits = append(edits, edit{' ', a[x-1]})
+		x--
+		y--
+	}
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+func replaced(a, b []string) []edit {
+	edits := make([]edit, 0, len(a)+len(b))
+	for _, line := range a {
+		edits = append(edits, edit{'-', line})
+	}
+	for _, line := range b {
+		edits = append(edits, edit{'+', line})
+	}
+	return edits
+}
+
+// Split text in lines keeping their newline, the last line may not have one
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// The unified diff of the contents of path, with context lines around the changes,
+// empty when they are the same
+func unifiedDiff(path, old, new string, context int) string {
+	edits := diffLines(splitLines(old), splitLines(new))
+
+	// line numbers of the old and the new content before each edit
+	oldLine := make([]int, len(edits)+1)
+	newLine := make([]int, len(edits)+1)
+	for i, e := range edits {
+		oldLine[i+1], newLine[i+1] = oldLine[i], newLine[i]
+		if e.op != '+' {
+			oldLine[i+1]++
+		}
+		if e.op != '-' {
+			newLine[i+1]++
+		}
+	}
+
+	var buf bytes.Buffer
+	for i := 0; i < len(edits); {
+		if edits[i].op == ' ' {
+			i++
+			continue
+		}
+		if buf.Len() == 0 {
+			fmt.Fprintf(&buf, "--- %s\n+++ %s\n", path, path)
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		// extend the hunk to the changes separated by at most 2 * context lines
+		end := i + 1
+		for j := end; j < len(edits) && j-end < 2*context+1; j++ {
+			if edits[j].op != ' ' {
+				end = j + 1
+			}
+		}
+		stop := end + context
+		if stop > len(edits) {
+			stop = len(edits)
+		}
+
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n",
+			hunkRange(oldLine[start], oldLine[stop]-oldLine[start]),
+			hunkRange(newLine[start], newLine[stop]-newLine[start]))
+		for _, e := range edits[start:stop] {
+			buf.WriteByte(e.op)
+			buf.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = stop
+	}
+	return buf.String()
+}
+
+// The range of a hunk header, in the format of GNU diff
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
@@ -0,0 +1,116 @@
+package fswatcher
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Watch the nearest existing ancestor of the root until the root is created
+func (dw *DeepWatch) waitForRoot() error {
+	dw.mutex.Lock()
+	defer dw.mutex.Unlock()
+	return dw.approachRoot()
+}
+
+// Move the waiter to the nearest existing ancestor of the root, or start watching the root
+// when it exists. Must be called with dw.mutex held.
+func (dw *DeepWatch) approachRoot() error {
+	if dw.stopped {
+		return nil
+	}
+	if dw.waiter != nil {
+		dw.waiter.Stop()
+		dw.waiter = nil
+	}
+
+	for {
+		fileInfo, err := os.Stat(dw.root)
+		if err == nil {
+			dw.logger.Infof("Target created: %s", dw.root)
+			// start and deliver outside of the lock, the watchers take it as well
+			go dw.promote(fileInfo)
+			return nil
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		ancestor := existingAncestor(dw.root)
+		waiter := &Watcher{
+			Path:     ancestor,
+			Callable: dw.waiterCallable(ancestor),
+			logger:   dw.logger,
+		}
+		err = waiter.Watch()
+		if err == nil && (exists(dw.root) || existingAncestor(dw.root) != ancestor) {
+			// the next path element appeared before the waiter started, look again
+			waiter.Stop()
+			continue
+		}
+		if err == nil {
+			dw.logger.Infof("Wait for %s in %s", dw.root, ancestor)
+			dw.waiter = waiter
+			return nil
+		}
+		if _, statErr := os.Stat(ancestor); statErr == nil {
+			return err
+		}
+		// the ancestor was removed meanwhile, look again
+	}
+}
+
+func (dw *DeepWatch) promote(fileInfo os.FileInfo) {
+	if !dw.opts.scan {
+		dw.start(fileInfo)
+		dw.deliver(Event{Op: Create, Path: dw.root, Time: time.Now()})
+		return
+	}
+	dw.mutex.Lock()
+	dw.scanning = true
+	dw.mutex.Unlock()
+	dw.start(fileInfo)
+	// the creation of the root comes before its content
+	dw.send(Event{Op: Create, Path: dw.root, Time: time.Now()})
+	dw.scan()
+}
+
+// The callable of the waiter watching ancestor: move down when the next path
+// element appears, move up when ancestor is removed
+func (dw *DeepWatch) waiterCallable(ancestor string) Callable {
+	onChange := func(filePath string) {
+		if filePath != ancestor && filePath != dw.root &&
+			!strings.HasPrefix(dw.root, filePath+string(filepath.Separator)) {
+			return
+		}
+		dw.mutex.Lock()
+		defer dw.mutex.Unlock()
+		if err := dw.approachRoot(); err != nil {
+			dw.logger.Errorf("Wait for %s failed: %s", dw.root, err)
+		}
+	}
+	return Callable{
+		OnCreate: onChange,
+		OnRemove: onChange,
+		OnRename: onChange,
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func existingAncestor(path string) string {
+	for {
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package fswatcher_test
+
+import (
+	"testing"
+
+	"github.com/raomuyang/fswatcher"
+	"github.com/raomuyang/fswatcher/fswatchertest"
+)
+
+func TestWatch_WaitForCreation(t *testing.T) {
+	tree := fswatchertest.NewTree(t)
+	recorder := fswatchertest.NewRecorder(tree.Root)
+
+	if _, err := fswatcher.Watch(tree.Path("a/b/c"), recorder.Callable()); err == nil {
+		t.Error("expected an error for a missing target")
+	}
+
+	dw, err := fswatcher.Watch(tree.Path("a/b/c"), recorder.Callable(), fswatcher.WithWaitForCreation())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dw.Stop()
+
+	tree.Mkdir("a")
+	tree.WriteFile("a/ignored", "")
+	tree.Mkdir("a/b/c")
+	recorder.ExpectEvents(t, timeout, fswatchertest.Exactly, fswatchertest.Create("a/b/c"))
+
+	tree.WriteFile("a/b/c/d", "")
+	recorder.ExpectEvents(t, timeout, fswatchertest.Create("a/b/c/d"))
+}
+
+func TestWatch_WaitForFile(t *testing.T) {
+	tree := fswatchertest.NewTree(t, "a/")
+	recorder := fswatchertest.NewRecorder(tree.Root)
+
+	dw, err := fswatcher.Watch(tree.Path("a/b/conf.yml"), recorder.Callable(), fswatcher.WithWaitForCreation())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dw.Stop()
+
+	// the ancestor disappears and comes back
+	tree.Remove("a")
+	tree.Mkdir("a/b")
+	tree.WriteFile("a/b/conf.yml", "")
+	recorder.ExpectEvents(t, timeout, fswatchertest.Create("a/b/conf.yml"))
+	tree.AppendFile("a/b/conf.yml", "a: 1")
+	recorder.ExpectEvents(t, timeout, fswatchertest.Write("a/b/conf.yml"))
+}
@@ -0,0 +1,283 @@
+package fswatcher_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raomuyang/fswatcher"
+	"github.com/raomuyang/fswatcher/fswatchertest"
+)
+
+const timeout = 3 * time.Second
+
+func TestWatch(t *testing.T) {
+	tree := fswatchertest.NewTree(t, "a/")
+	recorder := fswatchertest.NewRecorder(tree.Root)
+
+	dw, err := fswatcher.Watch(tree.Root, recorder.Callable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dw.Stop()
+
+	tree.WriteFile("sub", "")
+	recorder.ExpectEvents(t, timeout, fswatchertest.Create("sub"))
+
+	tree.AppendFile("a/b.txt", "b")
+	recorder.ExpectEvents(t, timeout, fswatchertest.Create("a/b.txt"), fswatchertest.Write("a/b.txt"))
+
+	tree.Mkdir("a/c")
+	recorder.ExpectEvents(t, timeout, fswatchertest.Create("a/c"))
+	tree.WriteFile("a/c/d", "d")
+	recorder.ExpectEvents(t, timeout, fswatchertest.Create("a/c/d"))
+
+	tree.Rename("sub", "a/sub")
+	recorder.ExpectEvents(t, timeout, fswatchertest.AnyOrder,
+		fswatchertest.Rename("sub"), fswatchertest.Create("a/sub"))
+
+	tree.Remove("a")
+	recorder.ExpectEvents(t, timeout, fswatchertest.Remove("a"))
+
+	dw.Stop()
+	<-dw.Stopped()
+	tree.WriteFile("e", "")
+	recorder.ExpectNoEvents(t, 100*time.Millisecond)
+}
+
+func TestHandle(t *testing.T) {
+	tree := fswatchertest.NewTree(t)
+	recorder := fswatchertest.NewRecorder(tree.Root)
+
+	handler := fswatcher.Chain(recorder, fswatcher.Filter(func(event fswatcher.Event) bool {
+		return event.Op == fswatcher.Create
+	}))
+	dw, err := fswatcher.Handle(tree.Root, handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dw.Stop()
+
+	tree.WriteFile("a", "a")
+	recorder.ExpectEvents(t, timeout, fswatchertest.Create("a"))
+	tree.Remove("a")
+	recorder.ExpectNoEvents(t, 100*time.Millisecond)
+}
+
+func TestWatch_MaxDepth(t *testing.T) {
+	tree := fswatchertest.NewTree(t, "a/b/")
+	recorder := fswatchertest.NewRecorder(tree.Root)
+
+	dw, err := fswatcher.Watch(tree.Root, recorder.Callable(), fswatcher.WithMaxDepth(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dw.Stop()
+
+	tree.WriteFile("a/b/x", "")
+	tree.WriteFile("a/y", "")
+	tree.Mkdir("a/c")
+	tree.WriteFile("a/c/z", "")
+	tree.WriteFile("w", "")
+	recorder.ExpectEvents(t, timeout, fswatchertest.AnyOrder,
+		fswatchertest.Create("a/y"), fswatchertest.Create("a/c"), fswatchertest.Create("w"))
+	recorder.ExpectNoEvents(t, 100*time.Millisecond)
+	for _, event := range recorder.Events() {
+		if event.Path == "a/b/x" || event.Path == "a/c/z" {
+			t.Errorf("unexpected event beyond the maximum depth: %s", event)
+		}
+	}
+}
+
+func TestWatch_Sparse(t *testing.T) {
+	tree := fswatchertest.NewTree(t, "services/a/migrations/", "services/a/src/deep/", "lib/x/fixtures/", "lib/y/z/", "docs/")
+	recorder := fswatchertest.NewRecorder(tree.Root)
+
+	dw, err := fswatcher.Watch(tree.Root, recorder.Callable(),
+		fswatcher.WithSparseWatch("services/*/migrations/*.sql", "lib/**/fixtures/*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dw.Stop()
+	// the root, services, services/a, services/a/migrations, and lib with every folder below it
+	if watched := dw.Stats().WatchedDirs; watched != 9 {
+		t.Errorf("expected 9 watched folders, got %d", watched)
+	}
+
+	tree.WriteFile("services/a/src/deep/1.sql", "")
+	tree.WriteFile("services/a/migrations/README", "")
+	tree.WriteFile("docs/fixtures.json", "")
+	tree.WriteFile("services/a/migrations/1.sql", "")
+	tree.WriteFile("lib/x/fixtures/a.json", "")
+	tree.Mkdir("services/b/migrations")
+	// moved in with its content
+	staging := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(staging, "w", "fixtures"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(staging, "w"), tree.Path("lib/w")); err != nil {
+		t.Fatal(err)
+	}
+	// the events of the folders are not delivered: wait for their watches
+	deadline := time.Now().Add(timeout)
+	for dw.Stats().WatchedDirs != 13 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 13 watched folders, got %d", dw.Stats().WatchedDirs)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	tree.WriteFile("services/b/migrations/2.sql", "")
+	tree.WriteFile("lib/w/fixtures/b.json", "")
+	recorder.ExpectEvents(t, timeout, fswatchertest.AnyOrder,
+		fswatchertest.Create("services/a/migrations/1.sql"), fswatchertest.Create("lib/x/fixtures/a.json"),
+		fswatchertest.Create("services/b/migrations/2.sql"), fswatchertest.Create("lib/w/fixtures/b.json"))
+	recorder.ExpectNoEvents(t, 100*time.Millisecond)
+	for _, event := range recorder.Events() {
+		if event.Path == "services/a/src/deep/1.sql" || event.Path == "services/a/migrations/README" || event.Path == "docs/fixtures.json" {
+			t.Errorf("unexpected event outside the patterns: %s", event)
+		}
+	}
+
+	if _, err := fswatcher.Watch(tree.Root, recorder.Callable(), fswatcher.WithSparseWatch("{a")); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+func TestWatch_SparseNewFolder(t *testing.T) {
+	tree := fswatchertest.NewTree(t, "svc/old/migrations/")
+	recorder := fswatchertest.NewRecorder(tree.Root)
+
+	dw, err := fswatcher.Watch(tree.Root, recorder.Callable(), fswatcher.WithSparseWatch("**/migrations/*.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dw.Stop()
+
+	// a folder created later below an existing one is noticed
+	tree.Mkdir("svc/new")
+	waitWatched(t, dw, 5)
+	tree.Mkdir("svc/new/migrations")
+	waitWatched(t, dw, 6)
+	tree.WriteFile("svc/new/migrations/1.sql", "")
+	tree.WriteFile("svc/new/README", "")
+	recorder.ExpectEvents(t, timeout, fswatchertest.Exactly, fswatchertest.Create("svc/new/migrations/1.sql"))
+}
+
+func waitWatched(t *testing.T, dw *fswatcher.DeepWatch, count int64) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for dw.Stats().WatchedDirs != count {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d watched folders, got %d", count, dw.Stats().WatchedDirs)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWatch_InitialScan(t *testing.T) {
+	tree := fswatchertest.NewTree(t, "a.txt", "b/c.txt", ".git/HEAD", "b/.env")
+	recorder := fswatchertest.NewRecorder(tree.Root)
+	callable := recorder.Callable()
+	onExisting := callable.OnExisting
+	callable.OnExisting = func(filePath string) {
+		onExisting(filePath)
+		if filePath != tree.Path("a.txt") {
+			return
+		}
+		// changes made during the scan: b is not listed yet
+		if err := ioutil.WriteFile(tree.Path("b/new.txt"), nil, 0644); err != nil {
+			t.Error(err)
+		}
+		if err := ioutil.WriteFile(tree.Path("a.txt"), []byte("a"), 0644); err != nil {
+			t.Error(err)
+		}
+		// let the events arrive before the scan completes
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	dw, err := fswatcher.Watch(tree.Root, callable, fswatcher.WithInitialScan(), fswatcher.WithIgnoreHidden())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dw.Stop()
+	recorder.ExpectEvents(t, timeout, fswatchertest.InOrder,
+		fswatchertest.Existing("a.txt"), fswatchertest.Existing("b"), fswatchertest.Existing("b/c.txt"),
+		fswatchertest.Existing("b/new.txt"), fswatchertest.Ready(), fswatchertest.Write("a.txt"))
+	tree.WriteFile(".git/HEAD", "ref")
+	tree.WriteFile("b/d.txt", "")
+	recorder.ExpectEvents(t, timeout, fswatchertest.InOrder, fswatchertest.Create("b/d.txt"))
+	recorder.ExpectNoEvents(t, 100*time.Millisecond)
+
+	for i, event := range recorder.Events() {
+		if i < 4 && event.Op != fswatcher.Existing || i == 4 && event.Op != fswatcher.Ready {
+			t.Errorf("unexpected event %d: %s", i, event)
+		}
+		if event.Op == fswatcher.Create && event.Path == "b/new.txt" {
+			t.Errorf("unexpected Create of a file reported Existing")
+		}
+		if strings.Contains(event.Path, ".git") || strings.Contains(event.Path, ".env") {
+			t.Errorf("unexpected event of a hidden file: %s", event)
+		}
+	}
+}
+
+func TestWatch_InitialScanWait(t *testing.T) {
+	tree := fswatchertest.NewTree(t)
+	recorder := fswatchertest.NewRecorder(tree.Root)
+	dw, err := fswatcher.Watch(tree.Path("target"), recorder.Callable(),
+		fswatcher.WithInitialScan(), fswatcher.WithWaitForCreation())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dw.Stop()
+
+	staging := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(staging, "f"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(staging, tree.Path("target")); err != nil {
+		t.Fatal(err)
+	}
+	recorder.ExpectEvents(t, timeout, fswatchertest.InOrder,
+		fswatchertest.Create("target"), fswatchertest.Existing("target/f"), fswatchertest.Expected{Op: fswatcher.Ready, Path: "target"})
+}
+
+func TestWatch_Workers(t *testing.T) {
+	var entries []string
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 10; j++ {
+			entries = append(entries, fmt.Sprintf("d%d/e%d/", i, j))
+		}
+	}
+	tree := fswatchertest.NewTree(t, entries...)
+	recorder := fswatchertest.NewRecorder(tree.Root)
+	var reports []fswatcher.Progress
+	dw, err := fswatcher.Watch(tree.Root, recorder.Callable(), fswatcher.WithWorkers(4),
+		fswatcher.WithProgress(func(progress fswatcher.Progress) {
+			reports = append(reports, progress)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dw.Stop()
+	select {
+	case <-dw.Ready():
+	case <-time.After(timeout):
+		t.Fatal("the watch is not ready")
+	}
+
+	// the root, 10 folders and 100 sub folders
+	if watched := dw.Stats().WatchedDirs; watched != 111 {
+		t.Errorf("expected 111 watched folders, got %d", watched)
+	}
+	last := reports[len(reports)-1]
+	if last != (fswatcher.Progress{Dirs: 111, Watches: 111, Done: true}) {
+		t.Errorf("unexpected progress %+v", last)
+	}
+	tree.WriteFile("d9/e9/f", "")
+	recorder.ExpectEvents(t, timeout, fswatchertest.InOrder, fswatchertest.Create("d9/e9/f"))
+}
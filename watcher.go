@@ -3,7 +3,8 @@ package fswatcher
 import (
 	"github.com/fsnotify/fsnotify"
 	"github.com/pkg/errors"
-	log "github.com/sirupsen/logrus"
+	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -17,124 +18,323 @@ type Callable struct {
 	OnWrite func(filePath string)
 	// RENAME corresponding function
 	OnRename func(filePath string)
+	// RECREATE corresponding function (follow mode only, see WithFollow)
+	OnRecreate func(filePath string)
+	// EXISTING corresponding function, OnCreate when nil (see WithInitialScan)
+	OnExisting func(filePath string)
+	// READY corresponding function, called with the root (see WithInitialScan)
+	OnReady func(root string)
 }
 
-func (callable Callable) doOnCreate(filePath string)  {
+func (callable Callable) doOnCreate(filePath string) bool {
 	if callable.OnCreate != nil {
 		callable.OnCreate(filePath)
+		return true
 	}
+	return false
 }
 
-func (callable Callable) doOnRemove(filePath string)  {
+func (callable Callable) doOnRemove(filePath string) bool {
 	if callable.OnRemove != nil {
 		callable.OnRemove(filePath)
+		return true
 	}
+	return false
 }
 
-func (callable Callable) doOnWrite(filePath string)  {
+func (callable Callable) doOnWrite(filePath string) bool {
 	if callable.OnWrite != nil {
 		callable.OnWrite(filePath)
+		return true
 	}
+	return false
 }
 
-func (callable Callable) doOnRename(filePath string)  {
+func (callable Callable) doOnRename(filePath string) bool {
 	if callable.OnRename != nil {
 		callable.OnRename(filePath)
+		return true
 	}
+	return false
 }
 
-// The watcher of file/folder, listen to the changes of file or subitems
+func (callable Callable) doOnRecreate(filePath string) bool {
+	if callable.OnRecreate != nil {
+		callable.OnRecreate(filePath)
+		return true
+	}
+	return false
+}
+
+func (callable Callable) doOnExisting(filePath string) bool {
+	if callable.OnExisting != nil {
+		callable.OnExisting(filePath)
+		return true
+	}
+	return callable.doOnCreate(filePath)
+}
+
+func (callable Callable) doOnReady(root string) bool {
+	if callable.OnReady != nil {
+		callable.OnReady(root)
+		return true
+	}
+	return false
+}
+
+// Call the function corresponding to the operation of event, returns false if there is none
+func (callable Callable) dispatch(event Event) bool {
+	switch event.Op {
+	case Create:
+		return callable.doOnCreate(event.Path)
+	case Write:
+		return callable.doOnWrite(event.Path)
+	case Remove:
+		return callable.doOnRemove(event.Path)
+	case Rename:
+		return callable.doOnRename(event.Path)
+	case Recreate:
+		return callable.doOnRecreate(event.Path)
+	case Existing:
+		return callable.doOnExisting(event.Path)
+	case Ready:
+		return callable.doOnReady(event.Path)
+	}
+	return false
+}
+
+// The watcher of file/folder, listen to the changes of file or subitems.
+// A Watcher must not be copied once started, it can be restarted after it stopped.
 type Watcher struct {
 	// target path to watch
-	Path      string
-	Callable  Callable
-	stop      chan bool
-	fsWatcher *fsnotify.Watcher
+	Path     string
+	Callable Callable
+	mutex    sync.Mutex
+	stop     chan struct{}
+	stopped  chan struct{}
+	metrics  *watchMetrics
+	logger   Logger
+	follow   bool
+	native   bool
+	// receives the events instead of Callable when set
+	handler func(event Event) bool
+	moves   *moveTable
 }
 
-var lock sync.Mutex
+var closedChan = make(chan struct{})
+
+func init() {
+	close(closedChan)
+}
 
 // Start the watch process in a new goroutine
-func (watcher *Watcher) Watch() error {
-	lock.Lock()
-	if watcher.stop != nil {
-		return errors.New("already started")
+func (watcher *Watcher) Watch(opts ...Option) error {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	for watcher.stopped != nil {
+		stopped := watcher.stopped
+		select {
+		case <-stopped:
+		default:
+			if watcher.stop != nil {
+				return errors.New("already started")
+			}
+			// stopping, wait for the previous process to release the watcher without holding the
+			// lock: a callback of that process may call Stop. Another Watch may start meanwhile.
+			watcher.mutex.Unlock()
+			<-stopped
+			watcher.mutex.Lock()
+			continue
+		}
+		break
 	}
-	lock.Unlock()
 
-	watcher.stop = make(chan bool)
-	fsWatcher, err := fsnotify.NewWatcher()
-	watcher.fsWatcher = fsWatcher
+	if len(opts) > 0 || watcher.logger == nil {
+		o := newOptions(opts)
+		watcher.logger = o.logger
+		watcher.follow = o.follow
+		watcher.native = o.native
+	}
+	if watcher.moves == nil {
+		watcher.moves = newMoveTable()
+	}
 
+	b, err := newBackend(watcher.native)
 	if err != nil {
-		log.Fatalf("error: %s", err)
+		watcher.logger.Errorf("error: %s", err)
+		watcher.metrics.backendError()
 		return err
 	}
 
-	log.Infof("Start watcher: %s", watcher.Path)
-	go func() {
-		for {
+	var follow *followState
+	target := watcher.Path
+	if watcher.follow {
+		// watch the parent folder to notice the path when it reappears
+		follow = newFollowState(watcher.Path)
+		target = filepath.Dir(follow.path)
+	}
+	err = b.Add(target)
+	if err != nil {
+		b.Close()
+		watcher.metrics.backendError()
+		return err
+	}
+
+	watcher.logger.Infof("Start watcher: %s", watcher.Path)
+	watcher.metrics.watchAdded()
+
+	watcher.stop = make(chan struct{})
+	watcher.stopped = make(chan struct{})
+	go watcher.loop(b, follow, watcher.stop, watcher.stopped)
+	return nil
+}
+
+func (watcher *Watcher) loop(b backend, follow *followState, stop, stopped chan struct{}) {
+	defer func() {
+		b.Close()
+		watcher.metrics.watchRemoved()
+		watcher.logger.Infof("Watcher closed: %s", watcher.Path)
+		close(stopped)
+	}()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case event, ok := <-b.Events():
+			if !ok {
+				return
+			}
 			select {
-			case event, ok := <-fsWatcher.Events:
-				if !ok {
-					break
-				}
-				watcher.onEvent(event)
-			case err = <-fsWatcher.Errors:
-				if err != nil {
-					log.Warnf("fsnotify error: %s", err.Error())
-				}
-			case stop := <-watcher.stop:
-				if stop {
-					watcher.stop = nil
-					break
+			case <-stop:
+				return
+			default:
+			}
+			if follow != nil {
+				if gone := watcher.onFollowEvent(event, follow); gone {
+					return
 				}
+			} else if gone := watcher.onEvent(event); gone {
+				return
+			}
+		case err, ok := <-b.Errors():
+			if !ok {
+				return
+			}
+			if err != nil {
+				watcher.logger.Warnf("backend error: %s", err.Error())
+				watcher.metrics.backendError()
 			}
 		}
-	}()
-	return fsWatcher.Add(watcher.Path)
+	}
 }
 
-// Stop the watch process
-func (watcher Watcher) Stop() {
-	select {
-	case watcher.stop <- true:
-		log.Infof("Watcher closed: %s", watcher.Path)
-	case <-time.After(time.Second):
-		log.Infof("Watcher closed (second): %s", watcher.Path)
+// Stop the watch process. Stop can be called any number of times, also from a callback.
+// It does not wait: a callback already running may still complete, wait on Stopped for the
+// watcher to be released.
+func (watcher *Watcher) Stop() {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+	if watcher.stop != nil {
+		close(watcher.stop)
+		watcher.stop = nil
 	}
 }
 
-func (watcher Watcher) removeWatch(filePath string)  {
-	log.Debugf("Remove watch for %s", filePath)
-	watcher.fsWatcher.Remove(filePath)
-
-	if filePath == watcher.Path {
-		watcher.Stop()
+// Stopped returns a channel closed when the watch process has exited, after Stop or when
+// the target was removed. The channel is closed already when the watcher is not started.
+func (watcher *Watcher) Stopped() <-chan struct{} {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+	if watcher.stopped == nil {
+		return closedChan
 	}
+	return watcher.stopped
 }
 
 // see fsnotify: func (op Op) String() string
-func (watcher Watcher) onEvent(event fsnotify.Event) {
+// Returns true when the target itself is gone and the watch process should exit
+func (watcher *Watcher) onEvent(event backendEvent) (gone bool) {
 
-	log.Debugf("event: %v", event)
+	watcher.logger.Debugf("event: %v", event.Event)
+	watcher.metrics.received(event)
+
+	start := time.Now()
+	delivered := false
+
+	if event.extra&Overflow == Overflow {
+		watcher.logger.Warnf("Events lost: %s", watcher.Path)
+		delivered = watcher.emit(Event{Op: Overflow, Path: filepath.Clean(watcher.Path)})
+	}
 
 	if event.Op&fsnotify.Write == fsnotify.Write {
-		watcher.Callable.doOnWrite(event.Name)
+		delivered = watcher.emit(Event{Op: Write, Path: event.Name}) || delivered
 	}
 
 	if event.Op&fsnotify.Create == fsnotify.Create {
-		watcher.Callable.doOnCreate(event.Name)
+		delivered = watcher.emit(watcher.moved(event, Create)) || delivered
 	}
 
 	if event.Op&fsnotify.Rename == fsnotify.Rename {
 		// RENAME or REMOVE|RENAME (folder)
-		log.Infof("Rename: %s", watcher.Path)
-		watcher.removeWatch(event.Name)
-		watcher.Callable.doOnRename(event.Name)
+		watcher.logger.Infof("Rename: %s", event.Name)
+		if event.Op&fsnotify.Remove == fsnotify.Remove {
+			watcher.metrics.coalesce()
+		}
+		gone = event.Name == filepath.Clean(watcher.Path)
+		delivered = watcher.emit(watcher.moved(event, Rename)) || delivered
 	} else if event.Op&fsnotify.Remove == fsnotify.Remove {
-		log.Infof("Remove: %s", watcher.Path)
-		watcher.removeWatch(event.Name)
-		watcher.Callable.doOnRemove(event.Name)
+		watcher.logger.Infof("Remove: %s", event.Name)
+		gone = event.Name == filepath.Clean(watcher.Path)
+		delivered = watcher.emit(Event{Op: Remove, Path: event.Name}) || delivered
+	}
+
+	delivered = watcher.emitExtra(event) || delivered
+
+	if delivered {
+		watcher.metrics.observeSince(start)
+	} else {
+		watcher.metrics.drop()
+	}
+	return
+}
+
+// Deliver the operations only reported by the native backend
+func (watcher *Watcher) emitExtra(event backendEvent) bool {
+	delivered := false
+	if event.extra&Attrib == Attrib {
+		delivered = watcher.emit(Event{Op: Attrib, Path: event.Name})
+	}
+	if event.extra&CloseWrite == CloseWrite {
+		delivered = watcher.emit(Event{Op: CloseWrite, Path: event.Name}) || delivered
+	}
+	return delivered
+}
+
+// The Create or Rename event of a path moved to or away, paired with the other half of the
+// move by the cookie of the backend
+func (watcher *Watcher) moved(event backendEvent, op Op) Event {
+	e := Event{Op: op, Path: event.Name}
+	if event.cookie == 0 {
+		return e
+	}
+	e.Meta = map[string]string{"cookie": strconv.FormatUint(uint64(event.cookie), 10)}
+	if op == Rename {
+		watcher.moves.from(event.cookie, event.Name)
+	} else {
+		e.OldPath = watcher.moves.to(event.cookie)
+	}
+	return e
+}
+
+// Pass event to the handler if any, or to the Callable
+func (watcher *Watcher) emit(event Event) bool {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if watcher.handler != nil {
+		return watcher.handler(event)
 	}
+	return watcher.Callable.dispatch(event)
 }
@@ -0,0 +1,231 @@
+package fswatcher
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func waitClosed(t *testing.T, ch <-chan struct{}, what string) {
+	select {
+	case <-ch:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timeout waiting for %s", what)
+	}
+}
+
+func waitPath(t *testing.T, ch <-chan string, expected string) {
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case p := <-ch:
+			if p == expected {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timeout waiting for %s", expected)
+		}
+	}
+}
+
+func TestWatcher_StopIdempotent(t *testing.T) {
+	root := ".test-watcher-stop"
+	os.MkdirAll(root, os.ModePerm)
+	defer os.RemoveAll(root)
+
+	watcher := &Watcher{Path: root}
+	waitClosed(t, watcher.Stopped(), "stopped before start")
+	if err := watcher.Watch(); err != nil {
+		t.Fatal(err)
+	}
+	if err := watcher.Watch(); err == nil {
+		t.Error("expected already started error")
+	}
+	watcher.Stop()
+	watcher.Stop()
+	waitClosed(t, watcher.Stopped(), "stopped")
+	watcher.Stop()
+}
+
+func TestWatcher_Restart(t *testing.T) {
+	root := ".test-watcher-restart"
+	os.MkdirAll(root, os.ModePerm)
+	defer os.RemoveAll(root)
+
+	created := make(chan string, 10)
+	watcher := &Watcher{Path: root, Callable: Callable{
+		OnCreate: func(filePath string) {
+			created <- filePath
+		},
+	}}
+	if err := watcher.Watch(); err != nil {
+		t.Fatal(err)
+	}
+	watcher.Stop()
+	if err := watcher.Watch(); err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Stop()
+
+	sub := filepath.Join(root, "sub")
+	f, _ := os.Create(sub)
+	f.Close()
+	waitPath(t, created, sub)
+}
+
+func TestWatcher_ConcurrentStartStop(t *testing.T) {
+	root := ".test-watcher-concurrent"
+	os.MkdirAll(root, os.ModePerm)
+	defer os.RemoveAll(root)
+
+	watcher := &Watcher{Path: root}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				watcher.Watch()
+				watcher.Stop()
+				<-watcher.Stopped()
+			}
+		}()
+	}
+	wg.Wait()
+	watcher.Stop()
+	waitClosed(t, watcher.Stopped(), "stopped")
+}
+
+func TestWatcher_RestartWhileCallbackStops(t *testing.T) {
+	root := ".test-watcher-restart-stop"
+	os.MkdirAll(root, os.ModePerm)
+	defer os.RemoveAll(root)
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	var watcher *Watcher
+	watcher = &Watcher{Path: root, Callable: Callable{
+		OnCreate: func(filePath string) {
+			once.Do(func() {
+				close(entered)
+				<-release
+				watcher.Stop()
+			})
+		},
+	}}
+	if err := watcher.Watch(); err != nil {
+		t.Fatal(err)
+	}
+	f, _ := os.Create(filepath.Join(root, "sub"))
+	f.Close()
+	waitClosed(t, entered, "callback")
+
+	// stop while the callback runs, then restart: Watch waits for the callback, which stops
+	watcher.Stop()
+	restarted := make(chan error, 1)
+	go func() {
+		restarted <- watcher.Watch()
+	}()
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	select {
+	case err := <-restarted:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout waiting for the restart")
+	}
+	watcher.Stop()
+	waitClosed(t, watcher.Stopped(), "stopped")
+}
+
+func TestWatcher_TargetRemoved(t *testing.T) {
+	root := ".test-watcher-removed"
+	os.MkdirAll(root, os.ModePerm)
+	defer os.RemoveAll(root)
+
+	target := filepath.Join(root, "file")
+	f, _ := os.Create(target)
+	f.Close()
+
+	removed := make(chan string, 10)
+	watcher := &Watcher{Path: target, Callable: Callable{
+		OnRemove: func(filePath string) {
+			removed <- filePath
+		},
+	}}
+	if err := watcher.Watch(); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(target)
+	waitPath(t, removed, target)
+	waitClosed(t, watcher.Stopped(), "stopped")
+}
+
+func TestDeepWatch_ConcurrentStop(t *testing.T) {
+	root := ".test-deepwatch-stop"
+	os.MkdirAll(filepath.Join(root, "a", "b"), os.ModePerm)
+	defer os.RemoveAll(root)
+
+	dw, err := Watch(root, Callable{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dw.Stop()
+		}()
+	}
+	wg.Wait()
+	waitClosed(t, dw.Stopped(), "deep watch stopped")
+	if dirs := dw.Stats().WatchedDirs; dirs != 0 {
+		t.Errorf("expected no watched dirs after stop, got %d", dirs)
+	}
+}
+
+func TestDeepWatch_NewFolder(t *testing.T) {
+	root := ".test-deepwatch-new"
+	os.MkdirAll(root, os.ModePerm)
+	defer os.RemoveAll(root)
+
+	created := make(chan string, 10)
+	removed := make(chan string, 10)
+	dw, err := Watch(root, Callable{
+		OnCreate: func(filePath string) {
+			created <- filePath
+		},
+		OnRemove: func(filePath string) {
+			removed <- filePath
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dw.Stop()
+
+	sub := filepath.Join(root, "sub")
+	os.Mkdir(sub, os.ModePerm)
+	waitPath(t, created, sub)
+
+	file := filepath.Join(sub, "file")
+	f, _ := os.Create(file)
+	f.Close()
+	waitPath(t, created, file)
+
+	os.RemoveAll(sub)
+	waitPath(t, removed, sub)
+	select {
+	case p := <-removed:
+		if p == sub {
+			t.Errorf("removal of %s reported twice", sub)
+		}
+	case <-time.After(200 * time.Millisecond):
+	}
+}